@@ -0,0 +1,76 @@
+package main
+
+// 本地第三方登录验证服务, 用于测试大厅的 HTTP 登录验证
+// token 格式为 "ok_<uid>", 验证通过后返回 uid, 其他 token 均验证失败
+
+import (
+	"crypto/hmac"
+	"flag"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/nothollyhigh/kiss/log"
+	"io/ioutil"
+	"kisscluster/plaza/app"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	addr   = flag.String("addr", ":21100", "listen addr")
+	appId  = flag.String("appid", "kisscluster", "app id")
+	secret = flag.String("secret", "authstub-secret", "sign secret")
+)
+
+func onVerify(w http.ResponseWriter, r *http.Request) {
+	var (
+		req = &app.AuthVerifyReq{}
+		rsp = &app.AuthVerifyRsp{Code: -1}
+	)
+
+	defer func() {
+		data, _ := json.Marshal(rsp)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, req)
+	}
+	if err != nil {
+		rsp.Msg = "invalid body"
+		return
+	}
+
+	if req.AppId != *appId || !hmac.Equal([]byte(req.Sign), []byte(app.AuthSign(*secret, req.AppId, req.Token, req.Nonce, req.Timestamp))) {
+		rsp.Msg = "invalid sign"
+		log.Info("verify failed: invalid sign, token: '%v'", req.Token)
+		return
+	}
+
+	if !strings.HasPrefix(req.Token, "ok_") || len(req.Token) == len("ok_") {
+		rsp.Msg = "invalid token"
+		log.Info("verify failed: invalid token: '%v'", req.Token)
+		return
+	}
+
+	rsp.Code = 0
+	rsp.Uid = strings.TrimPrefix(req.Token, "ok_")
+	rsp.Timestamp = time.Now().Unix()
+	rsp.Sign = app.AuthSign(*secret, rsp.Uid, req.Token, req.Nonce, rsp.Timestamp)
+
+	log.Info("verify success, token: '%v', uid: '%v'", req.Token, rsp.Uid)
+}
+
+func main() {
+	flag.Parse()
+
+	http.HandleFunc("/verify", onVerify)
+
+	log.Info("authstub start on %v", *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		log.Fatal("authstub ListenAndServe failed: %v", err)
+	}
+}
@@ -3,3 +3,4 @@ go build plaza/plaza.go
 go build game/game.go
 go build gate/gate.go
 go build robot/robot.go
+go build authstub/authstub.go
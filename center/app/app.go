@@ -7,6 +7,7 @@ import (
 	"github.com/nothollyhigh/kiss/util"
 	"io"
 	"io/ioutil"
+	"kisscluster/proto"
 	"os"
 	"time"
 )
@@ -25,6 +26,8 @@ type Config struct {
 	LogDir  string `json:"LogDir"`
 	Refresh int    `json:"Refresh"`
 	SvrAddr string `json:"SvrAddr"`
+
+	Maintenance *proto.MaintenanceInfo `json:"Maintenance"`
 }
 
 func initConfig() {
@@ -76,6 +79,10 @@ func Run(version string) {
 
 	svrMgr.run()
 
+	if config.Maintenance != nil {
+		maintenance.Set(*config.Maintenance)
+	}
+
 	startServer()
 }
 
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+	"sync"
+	"time"
+)
+
+var (
+	banRegistry = &BanRegistry{
+		bans:   map[string]*proto.BanInfo{},
+		lifted: map[string]int64{},
+	}
+)
+
+// 集群的封禁记录, 由大厅同步而来, 大厅重连时据此补齐断线期间的变化;
+// lifted 为已解除的封禁 -> 解除时间, 保留 BAN_LIFTED_KEEP 秒
+type BanRegistry struct {
+	sync.Mutex
+	bans   map[string]*proto.BanInfo
+	lifted map[string]int64
+}
+
+// 记录封禁变化, 返回是否为新的变化
+func (reg *BanRegistry) apply(ban *proto.BanInfo, lift bool) bool {
+	reg.Lock()
+	defer reg.Unlock()
+
+	if lift {
+		if _, ok := reg.lifted[ban.Id]; ok {
+			return false
+		}
+		now := time.Now().Unix()
+		reg.prune(now)
+		reg.lifted[ban.Id] = now
+		delete(reg.bans, ban.Id)
+		return true
+	}
+
+	if _, ok := reg.bans[ban.Id]; ok {
+		return false
+	}
+	if _, ok := reg.lifted[ban.Id]; ok {
+		return false
+	}
+	reg.bans[ban.Id] = ban
+	return true
+}
+
+// 删除超过保留时间的解除记录
+func (reg *BanRegistry) prune(now int64) {
+	for id, at := range reg.lifted {
+		if now-at > proto.BAN_LIFTED_KEEP {
+			delete(reg.lifted, id)
+		}
+	}
+}
+
+func (reg *BanRegistry) list() ([]*proto.BanInfo, []string) {
+	reg.Lock()
+	defer reg.Unlock()
+
+	now := time.Now().Unix()
+	bans := make([]*proto.BanInfo, 0, len(reg.bans))
+	for id, ban := range reg.bans {
+		if ban.Expire > 0 && ban.Expire <= now {
+			delete(reg.bans, id)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	reg.prune(now)
+	lifted := make([]string, 0, len(reg.lifted))
+	for id := range reg.lifted {
+		lifted = append(lifted, id)
+	}
+	return bans, lifted
+}
+
+func onBanSync(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterBanSyncReq{}
+		rsp = &proto.CenterBanSyncRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil || req.Ban == nil {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	banRegistry.apply(req.Ban, req.Lift)
+	svrMgr.BroadcastPlazas(proto.NewMessage(proto.CMD_CENTER_BAN_NOTIFY, req), req.Plaza)
+
+	ctx.Write(rsp)
+
+	log.Info("onBanSync from %v: %v", req.Plaza, string(ctx.Body()))
+}
+
+// 合并大厅上报的封禁, 断线期间在该大厅发生的变化同步到其他大厅, 返回全部封禁
+func onBanList(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterBanListReq{}
+		rsp = &proto.CenterBanListRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	for _, id := range req.Lifted {
+		ban := &proto.BanInfo{Id: id}
+		if banRegistry.apply(ban, true) {
+			svrMgr.BroadcastPlazas(proto.NewMessage(proto.CMD_CENTER_BAN_NOTIFY, &proto.CenterBanSyncReq{
+				Plaza: req.Plaza,
+				Ban:   ban,
+				Lift:  true,
+			}), req.Plaza)
+		}
+	}
+	for _, ban := range req.Bans {
+		if ban != nil && banRegistry.apply(ban, false) {
+			svrMgr.BroadcastPlazas(proto.NewMessage(proto.CMD_CENTER_BAN_NOTIFY, &proto.CenterBanSyncReq{
+				Plaza: req.Plaza,
+				Ban:   ban,
+			}), req.Plaza)
+		}
+	}
+
+	rsp.Bans, rsp.Lifted = banRegistry.list()
+	ctx.Write(rsp)
+
+	log.Info("onBanList from %v, bans: %v, lifted: %v", req.Plaza, len(rsp.Bans), len(rsp.Lifted))
+}
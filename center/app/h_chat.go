@@ -0,0 +1,27 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+func onChatRelay(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterChatRelayReq{}
+		rsp = &proto.CenterChatRelayRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil || req.Chat == nil {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	svrMgr.BroadcastPlazas(proto.NewMessage(proto.CMD_CENTER_CHAT_NOTIFY, req.Chat), req.Plaza)
+
+	ctx.Write(rsp)
+
+	log.Debug("onChatRelay from %v: %v", req.Plaza, string(ctx.Body()))
+}
@@ -0,0 +1,24 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+func onSetMaintenance(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterSetMaintenanceReq{}
+		rsp = &proto.CenterSetMaintenanceRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil || req.KickDelay < 0 {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	maintenance.Set(req.MaintenanceInfo)
+
+	ctx.Write(rsp)
+}
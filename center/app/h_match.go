@@ -0,0 +1,67 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+	"time"
+)
+
+const (
+	ticketExpire = time.Minute
+)
+
+func randomId(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func onReserveRoom(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterReserveRoomReq{}
+		rsp = &proto.CenterReserveRoomRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil || len(req.Players) == 0 {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	game, ok := svrMgr.GetGame(req.Game)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "game server not found"
+		ctx.Write(rsp)
+		return
+	}
+
+	rsp.RoomId = req.RoomId
+	if !req.Spectate {
+		rsp.RoomId = randomId(8)
+	}
+	rsp.Tickets = map[string]string{}
+	for _, name := range req.Players {
+		rsp.Tickets[name] = randomId(16)
+	}
+
+	notify := &proto.CenterReserveRoomNotify{
+		RoomId:  rsp.RoomId,
+		Kind:    req.Kind,
+		Players: req.Players,
+		Tickets: rsp.Tickets,
+		Expire:  time.Now().Add(ticketExpire).Unix(),
+
+		Spectate: req.Spectate,
+		Target:   req.Target,
+	}
+	game.Client.SendMsg(proto.NewMessage(proto.CMD_CENTER_RESERVE_ROOM_NOTIFY, notify))
+
+	ctx.Write(rsp)
+
+	log.Info("onReserveRoom %v on %v, kind: %v, players: %v, spectate: %v", rsp.RoomId, req.Game, req.Kind, req.Players, req.Spectate)
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+// 按玩家所在大厅拆分结算并转发, 离线玩家由任意大厅处理
+func onSettle(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterSettleReq{}
+		rsp = &proto.CenterSettleRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil || req.Settlement == nil || req.Settlement.Id == "" {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	groups := map[*ServerInfo][]string{}
+	for name := range req.Settlement.Players {
+		var (
+			plaza *ServerInfo
+			ok    bool
+		)
+		if loc, online := userDir.Get(name); online {
+			plaza, ok = svrMgr.GetPlaza(loc.Plaza)
+		}
+		if !ok {
+			plaza, ok = svrMgr.AnyPlaza()
+		}
+		if !ok {
+			rsp.Code = -1
+			rsp.Msg = "no plaza available"
+			ctx.Write(rsp)
+			return
+		}
+		groups[plaza] = append(groups[plaza], name)
+	}
+
+	for plaza, names := range groups {
+		plaza.Client.SendMsg(proto.NewMessage(proto.CMD_CENTER_SETTLE_NOTIFY, &proto.CenterSettleNotify{
+			Settlement: req.Settlement,
+			Names:      names,
+		}))
+	}
+
+	ctx.Write(rsp)
+
+	log.Info("onSettle %v from %v, players: %v", req.Settlement.Id, req.Settlement.Game, len(req.Settlement.Players))
+}
+
+// 大厅处理完结算, 转发确认给提交结算的游戏服务器
+func onSettleAck(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterSettleAckReq{}
+		rsp = &proto.CenterSettleAckRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil || req.Id == "" {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	// 游戏服务器不在线时丢弃, 游戏服务器重新提交后由大厅去重再次确认
+	if game, ok := svrMgr.GetGame(req.Game); ok {
+		game.Client.SendMsg(proto.NewMessage(proto.CMD_CENTER_SETTLE_ACK_NOTIFY, req))
+	}
+
+	ctx.Write(rsp)
+
+	log.Debug("onSettleAck %v -> %v, names: %v", req.Id, req.Game, req.Names)
+}
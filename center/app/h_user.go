@@ -0,0 +1,149 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+func onUserOnline(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterUserOnlineReq{}
+		rsp = &proto.CenterUserOnlineRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil || req.Name == "" {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	userDir.Online(req.Plaza, req.Name)
+
+	ctx.Write(rsp)
+}
+
+func onUserOffline(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterUserOfflineReq{}
+		rsp = &proto.CenterUserOfflineRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	userDir.Offline(req.Plaza, req.Name)
+
+	ctx.Write(rsp)
+}
+
+func onUserSync(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterUserSyncReq{}
+		rsp = &proto.CenterUserSyncRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	userDir.Sync(req.Plaza, req.Names)
+
+	ctx.Write(rsp)
+}
+
+func onUserUpdateGame(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterUserUpdateGameReq{}
+		rsp = &proto.CenterUserUpdateGameRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	if !userDir.UpdateGame(req.Name, req.Game) {
+		rsp.Code = proto.CODE_USER_OFFLINE
+		rsp.Msg = "user offline"
+		ctx.Write(rsp)
+		return
+	}
+
+	ctx.Write(rsp)
+
+	if loc, ok := userDir.Get(req.Name); ok {
+		if plaza, ok := svrMgr.GetPlaza(loc.Plaza); ok {
+			plaza.Client.SendMsg(proto.NewMessage(proto.CMD_CENTER_USER_STATUS_NOTIFY, &loc))
+		}
+	}
+}
+
+func onUserLookup(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterUserLookupReq{}
+		rsp = &proto.CenterUserLookupRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	rsp.Users = userDir.Lookup(req.Names)
+
+	ctx.Write(rsp)
+}
+
+func onUserDeliver(ctx *net.RpcContext) {
+	var (
+		req = &proto.CenterUserDeliverReq{}
+		rsp = &proto.CenterUserDeliverRsp{}
+	)
+
+	if err := ctx.Bind(req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invalid body"
+		ctx.Write(rsp)
+		return
+	}
+
+	loc, ok := userDir.Get(req.To)
+	if !ok {
+		rsp.Code = proto.CODE_USER_OFFLINE
+		rsp.Msg = "user offline"
+		ctx.Write(rsp)
+		return
+	}
+
+	plaza, ok := svrMgr.GetPlaza(loc.Plaza)
+	if !ok {
+		rsp.Code = proto.CODE_USER_OFFLINE
+		rsp.Msg = "user offline"
+		ctx.Write(rsp)
+		return
+	}
+
+	notify := &proto.CenterUserDeliverNotify{
+		To:   req.To,
+		Cmd:  req.Cmd,
+		Body: req.Body,
+	}
+	plaza.Client.SendMsg(proto.NewMessage(proto.CMD_CENTER_USER_DELIVER_NOTIFY, notify))
+
+	ctx.Write(rsp)
+
+	log.Debug("onUserDeliver %v -> %v, cmd: %v", req.To, loc.Plaza, req.Cmd)
+}
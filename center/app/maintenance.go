@@ -0,0 +1,68 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"kisscluster/proto"
+	"sync"
+	"time"
+)
+
+var (
+	maintenance = &Maintenance{}
+)
+
+// 集群停服维护状态, 变化时同步到所有大厅, 到达结束时间自动退出维护
+type Maintenance struct {
+	sync.RWMutex
+	info  proto.MaintenanceInfo
+	timer *time.Timer
+}
+
+func (m *Maintenance) Set(info proto.MaintenanceInfo) {
+	info.KickAt = 0
+	if info.Enabled && info.KickDelay > 0 {
+		info.KickAt = time.Now().Unix() + int64(info.KickDelay)
+	}
+
+	m.Lock()
+	m.info = info
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	if info.Enabled && info.EndTime > 0 {
+		m.timer = time.AfterFunc(time.Until(time.Unix(info.EndTime, 0)), m.end)
+	}
+	m.Unlock()
+
+	log.Info("Maintenance Set: %+v", info)
+
+	m.broadcast()
+}
+
+func (m *Maintenance) end() {
+	m.Lock()
+	if !m.info.Enabled {
+		m.Unlock()
+		return
+	}
+	m.info.Enabled = false
+	m.timer = nil
+	m.Unlock()
+
+	log.Info("Maintenance end")
+
+	m.broadcast()
+}
+
+func (m *Maintenance) Get() proto.MaintenanceInfo {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.info
+}
+
+func (m *Maintenance) broadcast() {
+	info := m.Get()
+	svrMgr.BroadcastPlazas(proto.NewMessage(proto.CMD_CENTER_MAINTENANCE_NOTIFY, &info), "")
+}
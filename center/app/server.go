@@ -44,6 +44,19 @@ func onUpdateServerInfo(ctx *net.RpcContext) {
 
 func startServer() {
 	server.HandleRpcMethod(proto.RPC_METHOD_UPDATE_SERVER_INFO, onUpdateServerInfo)
+	server.HandleRpcMethod(proto.RPC_METHOD_CHAT_RELAY, onChatRelay)
+	server.HandleRpcMethod(proto.RPC_METHOD_USER_ONLINE, onUserOnline)
+	server.HandleRpcMethod(proto.RPC_METHOD_USER_OFFLINE, onUserOffline)
+	server.HandleRpcMethod(proto.RPC_METHOD_USER_SYNC, onUserSync)
+	server.HandleRpcMethod(proto.RPC_METHOD_USER_UPDATE_GAME, onUserUpdateGame)
+	server.HandleRpcMethod(proto.RPC_METHOD_USER_LOOKUP, onUserLookup)
+	server.HandleRpcMethod(proto.RPC_METHOD_USER_DELIVER, onUserDeliver)
+	server.HandleRpcMethod(proto.RPC_METHOD_RESERVE_ROOM, onReserveRoom)
+	server.HandleRpcMethod(proto.RPC_METHOD_BAN_SYNC, onBanSync)
+	server.HandleRpcMethod(proto.RPC_METHOD_BAN_LIST, onBanList)
+	server.HandleRpcMethod(proto.RPC_METHOD_SET_MAINTENANCE, onSetMaintenance)
+	server.HandleRpcMethod(proto.RPC_METHOD_SETTLE, onSettle)
+	server.HandleRpcMethod(proto.RPC_METHOD_SETTLE_ACK, onSettleAck)
 
 	util.Go(func() {
 		server.Start(config.SvrAddr)
@@ -44,6 +44,10 @@ func (mgr *SvrMgr) Add(svr *ServerInfo) (code int, err error) {
 		//同步游戏服务列表
 		msg := proto.NewMessage(proto.CMD_CENTER_UPDATE_GAME_LIST_NOTIFY, &mgr.Games)
 		svr.Client.SendMsg(msg)
+
+		//同步停服维护状态
+		info := maintenance.Get()
+		svr.Client.SendMsg(proto.NewMessage(proto.CMD_CENTER_MAINTENANCE_NOTIFY, &info))
 	case proto.SERVER_TYPE_GAME:
 		mgr.Games[svr.Id] = svr
 	default:
@@ -74,11 +78,54 @@ func (mgr *SvrMgr) Delete(svr *ServerInfo) {
 	}
 	mgr.Unlock()
 
-	if svr.Type == proto.SERVER_TYPE_GAME {
+	switch svr.Type {
+	case proto.SERVER_TYPE_PLAZA:
+		userDir.DeletePlaza(svr.Id)
+	case proto.SERVER_TYPE_GAME:
+		userDir.DeleteGame(svr.Id)
 		mgr.UpdateServerList()
 	}
 }
 
+func (mgr *SvrMgr) GetPlaza(id string) (*ServerInfo, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	plaza, ok := mgr.Plazas[id]
+	return plaza, ok
+}
+
+func (mgr *SvrMgr) GetGame(id string) (*ServerInfo, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	game, ok := mgr.Games[id]
+	return game, ok
+}
+
+// 任选一个大厅, 用于处理离线用户的数据
+func (mgr *SvrMgr) AnyPlaza() (*ServerInfo, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	for _, plaza := range mgr.Plazas {
+		return plaza, true
+	}
+	return nil, false
+}
+
+// 广播消息到除 except 以外的所有大厅
+func (mgr *SvrMgr) BroadcastPlazas(msg net.IMessage, except string) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	for id, plaza := range mgr.Plazas {
+		if id != except {
+			plaza.Client.SendMsg(msg)
+		}
+	}
+}
+
 func (mgr *SvrMgr) UpdateServerList() {
 	mgr.Lock()
 	defer mgr.Unlock()
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"kisscluster/proto"
+	"sync"
+)
+
+var (
+	userDir = &UserDir{
+		users: map[string]*proto.UserLocation{},
+	}
+)
+
+// 集群在线用户目录
+type UserDir struct {
+	sync.RWMutex
+	users map[string]*proto.UserLocation
+}
+
+func (dir *UserDir) Online(plaza string, name string) {
+	dir.Lock()
+	defer dir.Unlock()
+
+	dir.users[name] = &proto.UserLocation{
+		Name:  name,
+		Plaza: plaza,
+	}
+}
+
+// 只删除仍登记在该大厅的用户, 避免用户切换大厅后被旧大厅的下线请求删除
+func (dir *UserDir) Offline(plaza string, name string) {
+	dir.Lock()
+	defer dir.Unlock()
+
+	if loc, ok := dir.users[name]; ok && loc.Plaza == plaza {
+		delete(dir.users, name)
+	}
+}
+
+func (dir *UserDir) Sync(plaza string, names []string) {
+	dir.Lock()
+	defer dir.Unlock()
+
+	dir.deletePlaza(plaza)
+	for _, name := range names {
+		dir.users[name] = &proto.UserLocation{
+			Name:  name,
+			Plaza: plaza,
+		}
+	}
+
+	log.Info("UserDir Sync %v users from %v", len(names), plaza)
+}
+
+func (dir *UserDir) UpdateGame(name string, game string) bool {
+	dir.Lock()
+	defer dir.Unlock()
+
+	loc, ok := dir.users[name]
+	if ok {
+		loc.Game = game
+	}
+	return ok
+}
+
+func (dir *UserDir) Get(name string) (proto.UserLocation, bool) {
+	dir.RLock()
+	defer dir.RUnlock()
+
+	if loc, ok := dir.users[name]; ok {
+		return *loc, true
+	}
+	return proto.UserLocation{}, false
+}
+
+func (dir *UserDir) Lookup(names []string) map[string]*proto.UserLocation {
+	dir.RLock()
+	defer dir.RUnlock()
+
+	users := map[string]*proto.UserLocation{}
+	for _, name := range names {
+		if loc, ok := dir.users[name]; ok {
+			cp := *loc
+			users[name] = &cp
+		}
+	}
+	return users
+}
+
+// 大厅断开, 删除该大厅的所有用户
+func (dir *UserDir) DeletePlaza(plaza string) {
+	dir.Lock()
+	defer dir.Unlock()
+
+	dir.deletePlaza(plaza)
+}
+
+func (dir *UserDir) deletePlaza(plaza string) {
+	for name, loc := range dir.users {
+		if loc.Plaza == plaza {
+			delete(dir.users, name)
+		}
+	}
+}
+
+// 游戏服务器断开, 清除用户的游戏位置
+func (dir *UserDir) DeleteGame(game string) {
+	dir.Lock()
+	defer dir.Unlock()
+
+	for _, loc := range dir.users {
+		if loc.Game == game {
+			loc.Game = ""
+		}
+	}
+}
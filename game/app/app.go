@@ -16,6 +16,8 @@ var (
 	config     = &Config{}
 	json       = jsoniter.ConfigCompatibleWithStandardLibrary
 	confpath   = flag.String("config", "./conf/game.json", "config file path, default is conf/game.json")
+	replayFile = flag.String("replay", "", "replay a recorded match file and exit")
+	verifyId   = flag.String("verify", "", "verify the seed of a settlement in the ledger and exit")
 
 	logout = io.Writer(nil)
 )
@@ -25,11 +27,35 @@ type Config struct {
 
 	LogDir string `json:"LogDir"`
 
+	DataDir string `json:"DataDir"`
+
 	SvrID string `json:"SvrID"`
 
 	CenterAddr string `json:"CenterAddr"`
 
 	SvrAddr string `json:"SvrAddr"`
+
+	ClientAddr string `json:"ClientAddr"`
+
+	AuthKickThreshold int `json:"AuthKickThreshold"`
+
+	TrustedGates []string `json:"TrustedGates"`
+
+	Kinds map[string]*KindConfig `json:"Kinds"`
+
+	RoomCapacityMax int `json:"RoomCapacityMax"`
+	ReconnectHold   int `json:"ReconnectHold"`
+	SpectatorMax    int `json:"SpectatorMax"`
+
+	LoadReport int `json:"LoadReport"`
+
+	SettleRetry int `json:"SettleRetry"`
+
+	ReplayKeepDays int `json:"ReplayKeepDays"`
+
+	SnapshotInterval int `json:"SnapshotInterval"`
+
+	FairSecret string `json:"FairSecret"`
 }
 
 func initConfig() {
@@ -47,6 +73,10 @@ func initConfig() {
 		log.Panic("initConfig json.Unmarshal Failed: %v", err)
 	}
 
+	if config.DataDir == "" {
+		config.DataDir = "./data/game/"
+	}
+
 }
 
 func initLog() {
@@ -76,10 +106,39 @@ func Run(version string) {
 
 	initConfig()
 
+	// 回放录像后退出
+	if *replayFile != "" {
+		initGameLogics()
+		if err := runReplay(*replayFile, os.Stdout); err != nil {
+			log.Error("replay %v failed: %v", *replayFile, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// 校验结算的随机数种子后退出
+	if *verifyId != "" {
+		if err := runVerify(*verifyId, os.Stdout); err != nil {
+			log.Error("verify %v failed: %v", *verifyId, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	initLog()
 
 	log.Info("app version: '%v'", version)
 
+	initGameLogics()
+	initFair()
+
+	reservationMgr.run()
+	roomMgr.init()
+	settlementMgr.init()
+	replayMgr.init()
+	snapshotMgr.init()
+	snapshotMgr.restore()
+
 	startCenterSession()
 
 	startTcpServer()
@@ -88,5 +147,6 @@ func Run(version string) {
 func Stop() {
 	stopCenterSession()
 	stopTcpServer()
+	settlementMgr.stop()
 
 }
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"kisscluster/proto"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+const (
+	botPrefix = "bot#" // 机器人名字前缀, 机器人不登记到 RoomMgr, 只需在房间内不重名
+)
+
+var (
+	botCreators = map[string]BotStrategyCreator{
+		proto.GAME_KIND_DICE: newDiceBot,
+	}
+)
+
+// 机器人策略, 每个机器人一个实例, 所有方法都在房间 goroutine 中调用;
+// 机器人收到的推送与坐在该座位上的玩家相同, 通过 room.BotMessage 发送游戏逻辑消息;
+// 策略不应使用 room.Rand, 否则会改变游戏逻辑的随机数序列, 回放时无法重现
+type BotStrategy interface {
+	// 收到推送, v 为推送的消息结构
+	OnNotify(room *Room, name string, cmd uint32, v interface{})
+}
+
+// 每个机器人创建一个策略实例
+type BotStrategyCreator func() BotStrategy
+
+// 注册机器人策略, name 与游戏逻辑的注册名相同, 应在 Run 之前调用
+func RegisterBotStrategy(name string, creator BotStrategyCreator) {
+	botCreators[name] = creator
+}
+
+// 机器人发送的游戏逻辑消息, 在当前操作完成后与玩家消息一样交给游戏逻辑
+type botMessage struct {
+	name string
+	data []byte
+}
+
+// 以下方法只在房间 goroutine 中调用
+
+// 机器人发送游戏逻辑消息
+func (room *Room) BotMessage(name string, v interface{}) {
+	i := room.seatOf(name)
+	if i < 0 || room.seats[i].bot == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Error("Room %v bot %v Marshal failed: %v", room.Id, name, err)
+		return
+	}
+	room.botInbox = append(room.botInbox, &botMessage{name: name, data: data})
+}
+
+// 处理机器人在本次操作中发送的消息, 避免在逻辑推送过程中重入逻辑
+func (room *Room) flushBots() {
+	for len(room.botInbox) > 0 {
+		inbox := room.botInbox
+		room.botInbox = nil
+		for _, m := range inbox {
+			if room.state == proto.ROOM_STATE_PLAYING {
+				room.message(m.name, m.data)
+			}
+		}
+	}
+}
+
+func (room *Room) notifyBot(seat *Seat, cmd uint32, v interface{}) {
+	if seat.bot != nil {
+		seat.bot.OnNotify(room, seat.Name, cmd, v)
+	}
+}
+
+// 房间内的真人玩家数
+func (room *Room) humans() int {
+	n := 0
+	for _, seat := range room.seats {
+		if seat != nil && seat.bot == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// 有真人玩家等待且有空座位时, BotWait 后用机器人补满; 匹配预留的房间不补
+func (room *Room) armBots() {
+	if room.botWait <= 0 || room.botCreator == nil || room.botTimer != nil || room.replaying ||
+		len(room.reserved) > 0 || room.state != proto.ROOM_STATE_WAITING ||
+		room.humans() == 0 || room.count() >= room.capacity {
+		return
+	}
+	room.botTimer = time.AfterFunc(room.botWait, func() {
+		room.post(func() {
+			room.botTimer = nil
+			room.fillBots()
+		})
+	})
+}
+
+func (room *Room) stopBots() {
+	if room.botTimer != nil {
+		room.botTimer.Stop()
+		room.botTimer = nil
+	}
+}
+
+func (room *Room) fillBots() {
+	if room.state != proto.ROOM_STATE_WAITING || room.humans() == 0 {
+		return
+	}
+
+	added := []string{}
+	for i, seat := range room.seats {
+		if seat != nil {
+			continue
+		}
+		name := botPrefix + randomId(4)
+		for room.seatOf(name) >= 0 {
+			name = botPrefix + randomId(4)
+		}
+		room.seats[i] = &Seat{Name: name, Ready: true, bot: room.botCreator()}
+		room.event(proto.ROOM_EVENT_JOINED, name)
+		room.logic.OnJoin(room, name)
+		added = append(added, name)
+	}
+	if len(added) == 0 {
+		return
+	}
+
+	log.Info("Room %v add bots: %v", room.Id, added)
+
+	room.checkStart()
+}
+
+// 机器人总是准备好的, 一局结束后重新准备
+func (room *Room) readyBots() {
+	for _, seat := range room.seats {
+		if seat != nil && seat.bot != nil && !seat.Ready {
+			seat.Ready = true
+			room.event(proto.ROOM_EVENT_READY, seat.Name)
+		}
+	}
+}
+
+// 未配置 BotSettle 时从结算中去掉机器人, 并按原名次重新计算真人玩家的名次
+func (room *Room) settleResults(results map[string]*proto.SettlementResult) map[string]*proto.SettlementResult {
+	if room.botSettle {
+		return results
+	}
+
+	humans := map[string]*proto.SettlementResult{}
+	ranks := []int{}
+	for name, result := range results {
+		if i := room.seatOf(name); i >= 0 && room.seats[i].bot != nil {
+			continue
+		}
+		humans[name] = result
+		if result.Rank > 0 && indexOfInt(ranks, result.Rank) < 0 {
+			ranks = append(ranks, result.Rank)
+		}
+	}
+	sort.Ints(ranks)
+	for _, result := range humans {
+		if result.Rank > 0 {
+			result.Rank = indexOfInt(ranks, result.Rank) + 1
+		}
+	}
+	return humans
+}
+
+func indexOfInt(list []int, v int) int {
+	for i, x := range list {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// 示例游戏 dice 的机器人: 开局后随机等待 1~3 秒掷出
+type DiceBot struct{}
+
+func newDiceBot() BotStrategy {
+	return &DiceBot{}
+}
+
+func (bot *DiceBot) OnNotify(room *Room, name string, cmd uint32, v interface{}) {
+	notify, ok := v.(*proto.DiceNotify)
+	if !ok || cmd != proto.CMD_GAME_LOGIC_NOTIFY || notify.Type != proto.DICE_NOTIFY_START {
+		return
+	}
+	delay := time.Second + time.Duration(rand.Int63n(int64(time.Second*2)))
+	room.After(delay, func() {
+		room.BotMessage(name, &proto.DiceReq{Action: proto.DICE_ACTION_ROLL})
+	})
+}
@@ -13,13 +13,25 @@ var (
 )
 
 func updateGameInfo() {
+	rooms, players, spectators := roomMgr.Load()
+	overruns, dropped, maxCost := tickStats.Reset()
+
 	var (
 		req = &proto.CenterUpdateServerInfoReq{
 			proto.ServerInfo{
 				Id:   config.SvrID,
 				Type: proto.SERVER_TYPE_GAME,
-				Info: map[string]interface{}{
-					"addr": config.SvrAddr,
+				Info: &proto.GameInfo{
+					Addr:       config.SvrAddr,
+					ClientAddr: config.ClientAddr,
+					Rooms:      rooms,
+					Players:    players,
+					Spectators: spectators,
+					Kinds:      gameKinds(),
+
+					TickOverruns: overruns,
+					TickDropped:  dropped,
+					TickMaxCost:  int(maxCost / time.Millisecond),
 				},
 			},
 		}
@@ -42,6 +54,29 @@ func updateGameInfo() {
 func onConnectedCenter(client *net.RpcClient) {
 	centerSession = client
 	updateGameInfo()
+	util.Go(settlementMgr.Resubmit)
+}
+
+// 更新用户所在的游戏服务器, game 为空表示离开
+func updateUserGame(name string, game string) {
+	util.Go(func() {
+		var (
+			req = &proto.CenterUserUpdateGameReq{
+				Name: name,
+				Game: game,
+			}
+			rsp = &proto.CenterUserUpdateGameRsp{}
+		)
+
+		err := centerSession.Call(proto.RPC_METHOD_USER_UPDATE_GAME, req, rsp, time.Second*3)
+		if err != nil {
+			log.Error("updateUserGame %v failed: %v", name, err)
+			return
+		}
+		if rsp.Code != 0 {
+			log.Info("updateUserGame %v failed, code: %v, msg: %v", name, rsp.Code, rsp.Msg)
+		}
+	})
 }
 
 func startCenterSession() {
@@ -51,6 +86,8 @@ func startCenterSession() {
 	)
 
 	// netengine.Handle(proto.CMD_CENTER_UPDATE_GAME_LIST_NOTIFY, onUpdateGameListNotify)
+	netengine.Handle(proto.CMD_CENTER_RESERVE_ROOM_NOTIFY, onReserveRoomNotify)
+	netengine.Handle(proto.CMD_CENTER_SETTLE_ACK_NOTIFY, onSettleAckNotify)
 
 	centerSession, err = net.NewRpcClient(config.CenterAddr, netengine, nil, onConnectedCenter)
 	if err != nil {
@@ -0,0 +1,226 @@
+package app
+
+import (
+	"kisscluster/proto"
+	"time"
+)
+
+const (
+	diceRollTimeout = time.Second * 15
+
+	diceExp     = 10 // 每局经验
+	diceWinExp  = 20 // 赢家额外经验
+	diceWinCoin = 10 // 赢家金币奖励
+)
+
+// 示例游戏: 掷骰子, 点数在全部掷出前只下发给本人, 观战者只能看到谁已掷出, 超时未掷的玩家(包括掉线的玩家)自动掷出
+type DiceLogic struct {
+	points   map[string]int
+	deadline time.Time
+	timer    int64
+}
+
+func newDiceLogic() GameLogic {
+	return &DiceLogic{}
+}
+
+func (dice *DiceLogic) OnCreate(room *Room) {
+}
+
+func (dice *DiceLogic) OnJoin(room *Room, name string) {
+}
+
+func (dice *DiceLogic) OnLeave(room *Room, name string) {
+}
+
+func (dice *DiceLogic) OnStart(room *Room) {
+	dice.points = map[string]int{}
+	dice.deadline = room.Now().Add(diceRollTimeout)
+	dice.timer = room.After(diceRollTimeout, func() {
+		dice.timeout(room)
+	})
+
+	room.Broadcast(&proto.DiceNotify{
+		Type:     proto.DICE_NOTIFY_START,
+		Deadline: dice.deadline.Unix(),
+	})
+}
+
+func (dice *DiceLogic) OnMessage(room *Room, name string, data []byte) {
+	req := &proto.DiceReq{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return
+	}
+	if req.Action != proto.DICE_ACTION_ROLL || room.State() != proto.ROOM_STATE_PLAYING {
+		return
+	}
+	if _, rolled := dice.points[name]; rolled {
+		return
+	}
+
+	dice.roll(room, name)
+	if len(dice.points) == len(room.Players()) {
+		dice.finish(room)
+	}
+}
+
+func (dice *DiceLogic) OnTick(room *Room, now time.Time) {
+}
+
+// 超时未掷的玩家自动掷出
+func (dice *DiceLogic) timeout(room *Room) {
+	if room.State() != proto.ROOM_STATE_PLAYING {
+		return
+	}
+	for _, name := range room.Players() {
+		if _, rolled := dice.points[name]; !rolled {
+			dice.roll(room, name)
+		}
+	}
+	dice.finish(room)
+}
+
+func (dice *DiceLogic) OnEnd(room *Room) {
+	dice.points = nil
+}
+
+// 掉线不影响游戏, 超时后自动掷出
+func (dice *DiceLogic) OnOffline(room *Room, name string) int {
+	return OFFLINE_CONTINUE
+}
+
+func (dice *DiceLogic) OnReconnect(room *Room, name string) {
+	notify := &proto.DiceNotify{
+		Type:     proto.DICE_NOTIFY_SNAPSHOT,
+		Point:    dice.points[name],
+		Deadline: dice.deadline.Unix(),
+	}
+	for _, player := range room.Players() {
+		if _, rolled := dice.points[player]; rolled {
+			notify.Rolled = append(notify.Rolled, player)
+		}
+	}
+	room.Send(name, notify)
+}
+
+func (dice *DiceLogic) OnForfeit(room *Room, name string) {
+}
+
+// 广播的开始和结果都是公开信息
+func (dice *DiceLogic) SpectatorView(room *Room, v interface{}) (interface{}, bool) {
+	return v, true
+}
+
+func (dice *DiceLogic) SpectatorState(room *Room, key string) bool {
+	return true
+}
+
+// 观战者只能看到已掷出的玩家, 看不到点数
+func (dice *DiceLogic) OnSpectate(room *Room, name string) {
+	if room.State() != proto.ROOM_STATE_PLAYING {
+		return
+	}
+	notify := &proto.DiceNotify{
+		Type:     proto.DICE_NOTIFY_SNAPSHOT,
+		Deadline: dice.deadline.Unix(),
+	}
+	for _, player := range room.Players() {
+		if _, rolled := dice.points[player]; rolled {
+			notify.Rolled = append(notify.Rolled, player)
+		}
+	}
+	room.SendSpectator(name, notify)
+}
+
+// 快照中的剩余时间为毫秒, 停服期间不计入回合时间
+type diceSnapshot struct {
+	Points    map[string]int `json:"points"`
+	Remaining int64          `json:"remaining"`
+}
+
+func (dice *DiceLogic) Save(room *Room) ([]byte, error) {
+	return json.Marshal(&diceSnapshot{
+		Points:    dice.points,
+		Remaining: int64(dice.deadline.Sub(room.Now()) / time.Millisecond),
+	})
+}
+
+func (dice *DiceLogic) Load(room *Room, data []byte) error {
+	snap := &diceSnapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return err
+	}
+
+	remaining := time.Duration(snap.Remaining) * time.Millisecond
+	if remaining < time.Second {
+		remaining = time.Second
+	}
+	dice.points = snap.Points
+	if dice.points == nil {
+		dice.points = map[string]int{}
+	}
+	dice.deadline = room.Now().Add(remaining)
+	dice.timer = room.After(remaining, func() {
+		dice.timeout(room)
+	})
+	return nil
+}
+
+func (dice *DiceLogic) roll(room *Room, name string) {
+	point := room.Rand().Intn(6) + 1
+	dice.points[name] = point
+
+	for _, player := range room.Players() {
+		notify := &proto.DiceNotify{
+			Type: proto.DICE_NOTIFY_ROLLED,
+			Name: name,
+		}
+		if player == name {
+			notify.Point = point
+		}
+		room.Send(player, notify)
+	}
+	room.BroadcastSpectators(&proto.DiceNotify{
+		Type: proto.DICE_NOTIFY_ROLLED,
+		Name: name,
+	})
+}
+
+func (dice *DiceLogic) finish(room *Room) {
+	var (
+		max     int
+		winners []string
+	)
+	for _, name := range room.Players() {
+		point := dice.points[name]
+		if point > max {
+			max = point
+			winners = []string{name}
+		} else if point == max {
+			winners = append(winners, name)
+		}
+	}
+
+	room.CancelTimer(dice.timer)
+	room.Broadcast(&proto.DiceNotify{
+		Type:    proto.DICE_NOTIFY_RESULT,
+		Points:  dice.points,
+		Winners: winners,
+	})
+
+	results := map[string]*proto.SettlementResult{}
+	for _, name := range room.Players() {
+		results[name] = &proto.SettlementResult{Rank: 2, Exp: diceExp}
+	}
+	for _, name := range winners {
+		results[name] = &proto.SettlementResult{
+			Rank:   1,
+			Win:    true,
+			Exp:    diceExp + diceWinExp,
+			Assets: map[string]int64{"coin": diceWinCoin},
+		}
+	}
+	room.Settle(results)
+
+	room.End()
+}
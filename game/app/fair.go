@@ -0,0 +1,173 @@
+package app
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/nothollyhigh/kiss/log"
+	"io"
+	"kisscluster/proto"
+	"os"
+	"path/filepath"
+)
+
+var (
+	fairSecret []byte
+)
+
+// 服务器种子的密钥, 未配置 FairSecret 时每次启动随机生成
+func initFair() {
+	if config.FairSecret != "" {
+		fairSecret = []byte(config.FairSecret)
+		return
+	}
+	fairSecret = make([]byte, 32)
+	rand.Read(fairSecret)
+	log.Warn("FairSecret not configured, use a random secret")
+}
+
+// 生成下一局的服务器种子: 由密钥对房间、帧号和随机数做 HMAC 得到, 在玩家提交客户端种子之前确定
+func newFairSeed(room *Room) *proto.FairSeed {
+	mac := hmac.New(sha256.New, fairSecret)
+	fmt.Fprintf(mac, "%v:%v:%v:%v", config.SvrID, room.Id, room.frame, randomId(16))
+	serverSeed := hex.EncodeToString(mac.Sum(nil))
+
+	return &proto.FairSeed{
+		Commitment: proto.FairCommitment(serverSeed),
+		ServerSeed: serverSeed,
+	}
+}
+
+// 以下方法只在房间 goroutine 中调用
+
+func (room *Room) fairNotify(stage string) *proto.GameFairNotify {
+	notify := &proto.GameFairNotify{
+		Stage:  stage,
+		RoomId: room.Id,
+		Seed:   room.fair,
+	}
+	if stage != proto.FAIR_STAGE_REVEAL {
+		notify.Seed = room.fair.Committed()
+	}
+	return notify
+}
+
+// 当前应下发的阶段: 游戏中为开局, 否则为承诺
+func (room *Room) fairStage() string {
+	if room.state == proto.ROOM_STATE_PLAYING {
+		return proto.FAIR_STAGE_START
+	}
+	return proto.FAIR_STAGE_COMMIT
+}
+
+// 给加入或重连的玩家下发当前阶段的种子数据
+func (room *Room) sendFair(seat *Seat) {
+	if room.fair != nil {
+		room.send(seat, proto.CMD_GAME_FAIR_NOTIFY, room.fairNotify(room.fairStage()))
+	}
+}
+
+// 生成下一局的服务器种子并公布承诺, 在房间创建和一局结束时调用
+func (room *Room) commitSeed() {
+	if room.replaying {
+		return
+	}
+	room.fair = newFairSeed(room)
+	room.broadcast(proto.CMD_GAME_FAIR_NOTIFY, room.fairNotify(proto.FAIR_STAGE_COMMIT))
+}
+
+// 开局时由座位上玩家提交的客户端种子计算公开种子和随机数种子, 并公布, 在游戏逻辑使用随机数之前
+func (room *Room) startSeed() {
+	if room.fair == nil {
+		room.fair = newFairSeed(room)
+	}
+	seeds := make([]string, len(room.seats))
+	for i, seat := range room.seats {
+		if seat != nil {
+			seeds[i] = seat.clientSeed
+		}
+	}
+	room.fair.ClientSeeds = seeds
+	room.fair.PublicSeed = proto.FairPublicSeed(seeds)
+	room.fair.Seed = proto.FairSeedValue(room.fair.ServerSeed, room.fair.PublicSeed)
+	room.broadcast(proto.CMD_GAME_FAIR_NOTIFY, room.fairNotify(proto.FAIR_STAGE_START))
+}
+
+// 一局结束时公布服务器种子
+func (room *Room) revealSeed() {
+	if room.fair != nil {
+		room.broadcast(proto.CMD_GAME_FAIR_NOTIFY, room.fairNotify(proto.FAIR_STAGE_REVEAL))
+		room.fair = nil
+	}
+}
+
+// 在账本文件中查找结算
+func findSettlement(path string, id string) (*proto.Settlement, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		record := &LedgerRecord{}
+		if json.Unmarshal(scanner.Bytes(), record) != nil {
+			continue
+		}
+		if record.Type == LEDGER_SETTLE && record.Settlement != nil && record.Settlement.Id == id {
+			return record.Settlement, nil
+		}
+	}
+	return nil, scanner.Err()
+}
+
+// 离线校验账本中的结算: 服务器种子与承诺一致, 随机数种子由服务器种子和公开种子计算得到,
+// 有录像时还校验录像使用的种子; 当前账本中没有时在归档的账本中查找
+func runVerify(id string, w io.Writer) error {
+	paths, err := filepath.Glob(filepath.Join(config.DataDir, ledgerArchivePrefix+"*.jsonl"))
+	if err != nil {
+		return err
+	}
+	paths = append([]string{filepath.Join(config.DataDir, ledgerFile)}, paths...)
+
+	var s *proto.Settlement
+	for _, path := range paths {
+		if s, err = findSettlement(path, id); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if s != nil {
+			break
+		}
+	}
+	if s == nil {
+		return fmt.Errorf("settlement %v not found in %v", id, config.DataDir)
+	}
+	if s.Fair == nil {
+		return fmt.Errorf("settlement %v has no seed data", id)
+	}
+
+	fmt.Fprintf(w, "settlement %v, room: %v, kind: %v\n  commitment: %v\n  client seeds: %q\n  public seed: %v\n  server seed: %v\n  seed: %v\n",
+		s.Id, s.RoomId, s.Kind, s.Fair.Commitment, s.Fair.ClientSeeds, s.Fair.PublicSeed, s.Fair.ServerSeed, s.Fair.Seed)
+	if err = s.Fair.Verify(); err != nil {
+		return err
+	}
+
+	if s.Replay != "" {
+		records, err := readReplay(filepath.Join(config.DataDir, replayDir, s.Replay+replaySuffix))
+		if err != nil {
+			fmt.Fprintf(w, "replay %v not checked: %v\n", s.Replay, err)
+		} else if records[0].Header.Seed != s.Fair.Seed {
+			return fmt.Errorf("replay %v seed %v does not match", s.Replay, records[0].Header.Seed)
+		} else {
+			fmt.Fprintf(w, "replay %v seed matches\n", s.Replay)
+		}
+	}
+
+	fmt.Fprintf(w, "verify ok\n")
+	return nil
+}
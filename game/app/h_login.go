@@ -0,0 +1,142 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+	"kisscluster/session"
+	"sync"
+)
+
+var (
+	userClients = &UserClients{clients: map[string]*net.TcpClient{}}
+)
+
+// 每个用户当前的连接, 旧连接关闭时不清除新连接登记的位置
+type UserClients struct {
+	sync.Mutex
+	clients map[string]*net.TcpClient
+}
+
+func (uc *UserClients) Set(name string, client *net.TcpClient) {
+	uc.Lock()
+	defer uc.Unlock()
+
+	uc.clients[name] = client
+}
+
+// client 仍是用户当前的连接时删除并返回 true
+func (uc *UserClients) Delete(name string, client *net.TcpClient) bool {
+	uc.Lock()
+	defer uc.Unlock()
+
+	if uc.clients[name] != client {
+		return false
+	}
+	delete(uc.clients, name)
+	return true
+}
+
+func onGameLoginReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.GameLoginReq{}
+		rsp = &proto.GameLoginRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_GAME_LOGIN_RSP, rsp), kickClient)
+		return
+	}
+
+	r, ok := reservationMgr.Get(req.Ticket)
+	if !ok {
+		rsp.Code = proto.CODE_UNAUTHORIZED
+		rsp.Msg = "invalid ticket"
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_GAME_LOGIN_RSP, rsp), kickClient)
+		return
+	}
+
+	room, ok := roomMgr.Get(r.RoomId)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = ErrRoomNotExist.Error()
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_GAME_LOGIN_RSP, rsp), kickClient)
+		return
+	}
+
+	// 进入房间或观战成功后才登记会话, 进入房间时登记位置, 在房间 goroutine 中、登录响应之前调用
+	sess := router.Session(client)
+	bound := false
+	bind := func() {
+		bound = true
+		sess.Auth(r.Name, session.ROLE_USER)
+		// 只有座位上的玩家上报所在游戏, 观战不算在游戏中
+		if !r.Spectate {
+			userClients.Set(r.Name, client)
+			updateUserGame(r.Name, config.SvrID)
+		}
+		client.OnClose("disconnected", func(*net.TcpClient) {
+			roomMgr.Offline(r.Name, client)
+			if userClients.Delete(r.Name, client) {
+				updateUserGame(r.Name, "")
+			}
+		})
+	}
+	// 进入失败时撤销已登记的会话和位置
+	unbind := func() {
+		if !bound {
+			return
+		}
+		sess.Unauth()
+		if userClients.Delete(r.Name, client) {
+			updateUserGame(r.Name, "")
+		}
+	}
+
+	rsp.Name = r.Name
+	rsp.RoomId = r.RoomId
+	rsp.Kind = r.Kind
+	if r.Spectate {
+		rsp.Kind = room.Kind
+		rsp.Spectate = true
+		err = roomMgr.Watch(room, r.Name, client, func() {
+			bind()
+			reservationMgr.Use(req.Ticket)
+			rsp.Room = room.Snapshot()
+			client.SendMsg(proto.NewMessage(proto.CMD_GAME_LOGIN_RSP, rsp))
+		})
+		if err != nil {
+			unbind()
+			rsp.Code = -1
+			rsp.Msg = err.Error()
+			client.SendMsg(proto.NewMessage(proto.CMD_GAME_LOGIN_RSP, rsp))
+		}
+
+		log.Info("onGameLoginReq %v: spectate room: %v, ip: %v, err: %v", r.Name, r.RoomId, sess.Ip(), err)
+		return
+	}
+
+	// 在房间 goroutine 中回复登录响应, 保证先于房间推送和重连时的完整状态到达
+	_, err = roomMgr.Join(room, r.Name, client, func(seat int, reconnect bool) {
+		bind()
+		reservationMgr.Use(req.Ticket)
+		rsp.Room = room.Snapshot()
+		rsp.Reconnect = reconnect
+		client.SendMsg(proto.NewMessage(proto.CMD_GAME_LOGIN_RSP, rsp))
+	})
+	if err != nil {
+		unbind()
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+		client.SendMsg(proto.NewMessage(proto.CMD_GAME_LOGIN_RSP, rsp))
+	}
+
+	log.Info("onGameLoginReq %v: room: %v, ip: %v, err: %v", r.Name, r.RoomId, sess.Ip(), err)
+}
+
+func kickClient(client *net.TcpClient, err error) {
+	client.Stop()
+}
@@ -0,0 +1,167 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"sync"
+	"time"
+)
+
+const (
+	replayReqInterval = time.Second * 3 // 同一连接两次观看录像请求的最小间隔
+)
+
+var (
+	replayStreams = &ReplayStreams{streams: map[*net.TcpClient]*replayStream{}}
+)
+
+func onGameReplayReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err     error
+		records []*ReplayRecord
+		name    = router.Session(client).Name()
+		req     = &proto.GameReplayReq{}
+		rsp     = &proto.GameReplayRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || req.Speed < 0 {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_GAME_REPLAY_RSP, rsp))
+		return
+	}
+	if req.Speed == 0 {
+		req.Speed = 1
+	}
+
+	if err = replayStreams.Request(client); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+		client.SendMsg(proto.NewMessage(proto.CMD_GAME_REPLAY_RSP, rsp))
+		return
+	}
+
+	if records, err = replayMgr.Load(req.Id); err == nil && indexOf(records[0].Header.Seats, name) < 0 {
+		err = ErrReplayDenied
+	}
+	if err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+		client.SendMsg(proto.NewMessage(proto.CMD_GAME_REPLAY_RSP, rsp))
+		log.Info("onGameReplayReq %v, replay: %v, err: %v", name, req.Id, err)
+		return
+	}
+
+	header := records[0].Header
+	rsp.Id = header.Id
+	rsp.Kind = header.Kind
+	rsp.Start = header.Start
+	rsp.Seats = header.Seats
+	client.SendMsg(proto.NewMessage(proto.CMD_GAME_REPLAY_RSP, rsp))
+
+	stop := replayStreams.Start(client)
+	util.Go(func() {
+		streamReplay(client, name, records, req.Speed, stop)
+	})
+
+	log.Info("onGameReplayReq %v, replay: %v, speed: %v", name, req.Id, req.Speed)
+}
+
+// 按录像中的时间间隔推送广播和发给 name 的消息, stop 关闭或连接断开时停止
+func streamReplay(client *net.TcpClient, name string, records []*ReplayRecord, speed float64, stop chan struct{}) {
+	defer replayStreams.Done(client, stop)
+
+	begin := time.Now()
+	for _, rec := range records {
+		if rec.Type != REPLAY_OUT || (rec.Name != "" && rec.Name != name) {
+			continue
+		}
+		at := time.Duration(float64(rec.T)/speed) * time.Millisecond
+		if d := at - time.Since(begin); d > 0 {
+			select {
+			case <-time.After(d):
+			case <-stop:
+				return
+			}
+		}
+		if err := client.SendMsg(net.NewMessage(rec.Cmd, []byte(rec.Data))); err != nil {
+			return
+		}
+	}
+	client.SendMsg(proto.NewMessage(proto.CMD_GAME_REPLAY_END_NOTIFY, &proto.GameReplayEndNotify{Id: records[0].Header.Id}))
+}
+
+// 每个连接同时只推送一个录像, 新请求停止之前的推送, 请求间隔不小于 replayReqInterval
+type ReplayStreams struct {
+	sync.Mutex
+	streams map[*net.TcpClient]*replayStream
+}
+
+type replayStream struct {
+	stop      chan struct{}
+	requestAt time.Time
+}
+
+// 检查请求频率并记录请求时间
+func (rs *ReplayStreams) Request(client *net.TcpClient) error {
+	rs.Lock()
+	defer rs.Unlock()
+
+	s, ok := rs.streams[client]
+	if !ok {
+		s = &replayStream{}
+		rs.streams[client] = s
+		client.OnClose("replay", func(*net.TcpClient) {
+			rs.Remove(client)
+		})
+	}
+	if time.Since(s.requestAt) < replayReqInterval {
+		return ErrReplayFrequent
+	}
+	s.requestAt = time.Now()
+	return nil
+}
+
+// 停止连接上正在进行的推送, 返回新推送的停止信号
+func (rs *ReplayStreams) Start(client *net.TcpClient) chan struct{} {
+	rs.Lock()
+	defer rs.Unlock()
+
+	stop := make(chan struct{})
+	s, ok := rs.streams[client]
+	if !ok {
+		// 连接已关闭
+		close(stop)
+		return stop
+	}
+	if s.stop != nil {
+		close(s.stop)
+	}
+	s.stop = stop
+	return stop
+}
+
+// 推送结束
+func (rs *ReplayStreams) Done(client *net.TcpClient, stop chan struct{}) {
+	rs.Lock()
+	defer rs.Unlock()
+
+	if s, ok := rs.streams[client]; ok && s.stop == stop {
+		s.stop = nil
+	}
+}
+
+// 连接关闭, 停止推送
+func (rs *ReplayStreams) Remove(client *net.TcpClient) {
+	rs.Lock()
+	defer rs.Unlock()
+
+	if s, ok := rs.streams[client]; ok {
+		if s.stop != nil {
+			close(s.stop)
+		}
+		delete(rs.streams, client)
+	}
+}
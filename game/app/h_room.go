@@ -0,0 +1,143 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+func onGameRoomListReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.GameRoomListReq{}
+		rsp = &proto.GameRoomListRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_LIST_RSP, rsp))
+		return
+	}
+
+	rsp.Rooms = roomMgr.List(req.Kind)
+
+	client.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_LIST_RSP, rsp))
+}
+
+func onGameRoomCreateReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err  error
+		room *Room
+		name = router.Session(client).Name()
+		req  = &proto.GameRoomCreateReq{}
+		rsp  = &proto.GameRoomRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_CREATE_RSP, rsp))
+		return
+	}
+
+	if req.Capacity > roomMgr.capacityMax {
+		err = ErrInvalidRoom
+	} else if _, in := roomMgr.UserRoom(name); in {
+		err = ErrAlreadyInRoom
+	} else if room, err = roomMgr.Create("", req.Kind, req.Capacity, nil); err == nil {
+		if rsp.Seat, err = roomMgr.Join(room, name, client, nil); err != nil {
+			room.post(room.closeIfEmpty)
+		} else {
+			rsp.Room = room.Snapshot()
+		}
+	}
+	if err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_CREATE_RSP, rsp))
+
+	log.Info("onGameRoomCreateReq %v, kind: %v, capacity: %v, err: %v", name, req.Kind, req.Capacity, err)
+}
+
+func onGameRoomJoinReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err  error
+		name = router.Session(client).Name()
+		req  = &proto.GameRoomJoinReq{}
+		rsp  = &proto.GameRoomRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_JOIN_RSP, rsp))
+		return
+	}
+
+	room, ok := roomMgr.Get(req.RoomId)
+	if !ok {
+		err = ErrRoomNotExist
+	} else if rsp.Seat, err = roomMgr.Join(room, name, client, nil); err == nil {
+		rsp.Room = room.Snapshot()
+	}
+	if err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_JOIN_RSP, rsp))
+}
+
+func onGameRoomLeaveReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err  error
+		name = router.Session(client).Name()
+		rsp  = &proto.GameRoomRsp{}
+	)
+
+	// 观战者离开即结束观战
+	if _, watching := roomMgr.WatchingRoom(name); watching {
+		err = roomMgr.Unwatch(name)
+	} else {
+		err = roomMgr.Leave(name)
+	}
+	if err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_LEAVE_RSP, rsp))
+}
+
+func onGameRoomReadyReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.GameRoomReadyReq{}
+		rsp = &proto.GameRoomRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_READY_RSP, rsp))
+		return
+	}
+
+	if err = roomMgr.Ready(router.Session(client).Name(), req.Ready, req.ClientSeed); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_READY_RSP, rsp))
+}
+
+// 游戏逻辑消息, 消息体原样交给房间的游戏逻辑, 不回复响应
+func onGameLogicReq(client *net.TcpClient, msg net.IMessage) {
+	name := router.Session(client).Name()
+	if err := roomMgr.Message(name, msg.Body()); err != nil {
+		log.Debug("onGameLogicReq %v failed: %v", name, err)
+	}
+}
@@ -0,0 +1,158 @@
+package app
+
+import (
+	"errors"
+	"github.com/nothollyhigh/kiss/log"
+	"kisscluster/proto"
+	"sort"
+	"time"
+)
+
+var (
+	logicCreators = map[string]GameLogicCreator{
+		proto.GAME_KIND_DICE: newDiceLogic,
+	}
+
+	ErrKindNotSupported = errors.New("game kind not supported")
+)
+
+// 游戏逻辑, 房间把生命周期事件和玩家消息交给逻辑处理, 所有方法都在房间 goroutine 中调用,
+// 逻辑通过 room.Send/Broadcast 推送消息, 一局结束时调用 room.End
+type GameLogic interface {
+	OnCreate(room *Room)
+	OnJoin(room *Room, name string)
+	OnLeave(room *Room, name string)
+	OnStart(room *Room)
+	OnMessage(room *Room, name string, data []byte)
+	OnTick(room *Room, now time.Time)
+	OnEnd(room *Room)
+}
+
+// 可选接口, 固定帧率的房间每帧结束时取逻辑状态, 与上一帧比较后广播变化的部分,
+// 状态为 key -> 可序列化的值
+type StateLogic interface {
+	State(room *Room) map[string]interface{}
+}
+
+// 游戏中玩家掉线的处理方式
+const (
+	OFFLINE_CONTINUE = 0 // 继续游戏, 由逻辑代替掉线玩家操作或等待超时
+	OFFLINE_PAUSE    = 1 // 暂停游戏直到所有掉线玩家重连或保留座位到期
+	OFFLINE_FORFEIT  = 2 // 立即判负
+)
+
+// 可选接口, 处理游戏中的掉线重连, 未实现时掉线玩家的座位保留到本局结束
+type ReconnectLogic interface {
+	// 玩家掉线, 返回处理方式
+	OnOffline(room *Room, name string) int
+	// 玩家在保留时间内重连, 逻辑应下发恢复游戏所需的数据
+	OnReconnect(room *Room, name string)
+	// 选择判负或保留座位到期仍未重连
+	OnForfeit(room *Room, name string)
+}
+
+// 可选接口, 观战: 逻辑广播和状态推送发给观战者前经过过滤, 用于隐藏只对玩家可见的信息;
+// 未实现时观战者接收全部广播和状态, room.Send 发给单个玩家的消息不会发给观战者
+type SpectatorLogic interface {
+	// 广播消息 v 发给观战者的内容, 返回 false 时不发给观战者
+	SpectatorView(room *Room, v interface{}) (interface{}, bool)
+	// 状态 key 是否对观战者可见
+	SpectatorState(room *Room, key string) bool
+	// 观战者加入, 逻辑应通过 room.SendSpectator 下发当前局面
+	OnSpectate(room *Room, name string)
+}
+
+// 可选接口, 游戏中的房间定时调用 Save 保存快照到本地, 进程崩溃后以相同 SvrID 重启时,
+// 新建逻辑实例并调用 OnCreate 和 Load 恢复, 房间暂停等待玩家凭原票据重连;
+// 定时器不会保存, Load 应按需重新设置
+type SnapshotLogic interface {
+	Save(room *Room) ([]byte, error)
+	Load(room *Room, data []byte) error
+}
+
+// 每个房间创建一个逻辑实例
+type GameLogicCreator func() GameLogic
+
+// 注册游戏逻辑, 应在 Run 之前调用
+func RegisterGameLogic(name string, creator GameLogicCreator) {
+	logicCreators[name] = creator
+}
+
+// 游戏类型配置, Logic 为注册的逻辑名, 为空时与类型同名
+// Hz 大于 0 时房间以固定帧率运行: 玩家消息按帧批量处理, 每帧调用 OnTick 并广播状态变化;
+// 否则玩家消息立即处理, 按 Tick 间隔调用 OnTick;
+// SpectatorDelay 大于 0 时发给观战者的推送延迟该时间下发, 精度为一帧;
+// Record 为 true 时每局录像, 录像文件可用 -replay 参数回放;
+// BotWait 大于 0 时玩家创建的房间有空座位超过该时间后用机器人补满, 需注册同名的机器人策略,
+// BotSettle 为 false 时机器人不参与结算, 真人玩家的名次在去掉机器人后重新计算
+type KindConfig struct {
+	Logic          string `json:"Logic"`
+	Tick           int    `json:"Tick"`           // OnTick 间隔, 单位毫秒
+	Hz             int    `json:"Hz"`             // 固定帧率
+	SpectatorDelay int    `json:"SpectatorDelay"` // 观战延迟, 单位秒
+	Record         bool   `json:"Record"`
+	BotWait        int    `json:"BotWait"` // 单位秒
+	BotSettle      bool   `json:"BotSettle"`
+}
+
+func (cfg *KindConfig) logicName(kind string) string {
+	if cfg.Logic != "" {
+		return cfg.Logic
+	}
+	return kind
+}
+
+func (cfg *KindConfig) tick() time.Duration {
+	if cfg.Hz > 0 {
+		return time.Second / time.Duration(cfg.Hz)
+	}
+	if cfg.Tick > 0 {
+		return time.Millisecond * time.Duration(cfg.Tick)
+	}
+	return time.Second
+}
+
+func (cfg *KindConfig) spectatorDelay() time.Duration {
+	return time.Second * time.Duration(cfg.SpectatorDelay)
+}
+
+func (cfg *KindConfig) botWait() time.Duration {
+	return time.Second * time.Duration(cfg.BotWait)
+}
+
+// 检查配置的游戏类型都有对应的逻辑
+func initGameLogics() {
+	if len(config.Kinds) == 0 {
+		log.Panic("initGameLogics failed: no game kind configured")
+	}
+	for kind, cfg := range config.Kinds {
+		if _, ok := logicCreators[cfg.logicName(kind)]; !ok {
+			log.Panic("initGameLogics failed: logic '%v' for kind '%v' not registered", cfg.logicName(kind), kind)
+		}
+		if _, ok := botCreators[cfg.logicName(kind)]; cfg.BotWait > 0 && !ok {
+			log.Panic("initGameLogics failed: bot strategy '%v' for kind '%v' not registered", cfg.logicName(kind), kind)
+		}
+	}
+}
+
+// 本服务器支持的游戏类型
+func gameKinds() []string {
+	kinds := make([]string, 0, len(config.Kinds))
+	for kind := range config.Kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func newGameLogic(kind string) (GameLogic, *KindConfig, error) {
+	cfg, ok := config.Kinds[kind]
+	if !ok {
+		return nil, nil, ErrKindNotSupported
+	}
+	creator, ok := logicCreators[cfg.logicName(kind)]
+	if !ok {
+		return nil, nil, ErrKindNotSupported
+	}
+	return creator(), cfg, nil
+}
@@ -0,0 +1,397 @@
+package app
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/util"
+	"io"
+	"io/ioutil"
+	"kisscluster/proto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	replayDir    = "replay"
+	replaySuffix = ".jsonl.gz"
+
+	REPLAY_START   = "start"   // 开局, Header 为房间信息
+	REPLAY_IN      = "in"      // 玩家的游戏逻辑消息
+	REPLAY_OUT     = "out"     // 推送, Name 为空时为广播
+	REPLAY_OFFLINE = "offline" // 玩家掉线
+	REPLAY_ONLINE  = "online"  // 玩家重连
+	REPLAY_FORFEIT = "forfeit" // 保留座位到期
+	REPLAY_END     = "end"     // 一局结束或房间关闭
+)
+
+var (
+	replayMgr = &ReplayMgr{}
+
+	ErrInvalidReplay  = errors.New("invalid replay")
+	ErrReplayDenied   = errors.New("not a player of the replay")
+	ErrReplayFrequent = errors.New("replay requested too frequently")
+)
+
+// 录像头, Seats 为开局时的座位, 空座位为空字符串
+type ReplayHeader struct {
+	Id     string   `json:"id"`
+	RoomId string   `json:"roomId"`
+	Kind   string   `json:"kind"`
+	Start  int64    `json:"start"` // 开局时间, Unix 毫秒
+	Frame  int64    `json:"frame"` // 开局时的帧号
+	Seed   int64    `json:"seed"`
+	Seats  []string `json:"seats"`
+}
+
+// 录像记录, 每行一条 JSON, T 为距开局的毫秒数, F 为帧号
+type ReplayRecord struct {
+	T      int64         `json:"t"`
+	Frame  int64         `json:"f"`
+	Type   string        `json:"type"`
+	Name   string        `json:"name,omitempty"`
+	Cmd    uint32        `json:"cmd,omitempty"`
+	Data   string        `json:"data,omitempty"`
+	Header *ReplayHeader `json:"header,omitempty"`
+}
+
+// 一局的录像, 只在房间 goroutine 中使用; 回放时不写文件, 只收集逻辑推送用于比对
+type Recorder struct {
+	Id     string
+	start  time.Time
+	file   *os.File
+	gz     *gzip.Writer
+	closed bool
+	outs   []*ReplayRecord
+}
+
+func (r *Recorder) write(rec *ReplayRecord) {
+	if r.closed {
+		return
+	}
+	if r.file == nil {
+		if rec.Type == REPLAY_OUT {
+			r.outs = append(r.outs, rec)
+		}
+		return
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		log.Error("Recorder %v Marshal failed: %v", r.Id, err)
+		return
+	}
+	if _, err = r.gz.Write(append(data, '\n')); err != nil {
+		log.Error("Recorder %v write failed: %v", r.Id, err)
+	}
+}
+
+func (r *Recorder) close() {
+	if r.closed {
+		return
+	}
+	r.closed = true
+	if r.file != nil {
+		r.gz.Close()
+		r.file.Close()
+	}
+}
+
+// 录像管理, 录像保存在 DataDir/replay 下, 每局一个 gzip 压缩的 JSON lines 文件, 超过保留天数的自动删除
+type ReplayMgr struct {
+	dir  string
+	keep time.Duration
+}
+
+func (mgr *ReplayMgr) init() {
+	mgr.dir = filepath.Join(config.DataDir, replayDir)
+	if err := os.MkdirAll(mgr.dir, 0755); err != nil {
+		log.Panic("ReplayMgr init failed: %v", err)
+	}
+
+	mgr.keep = time.Hour * 24 * time.Duration(config.ReplayKeepDays)
+	if mgr.keep <= 0 {
+		mgr.keep = time.Hour * 24 * 7
+	}
+
+	util.Go(func() {
+		for {
+			mgr.cleanup()
+			time.Sleep(time.Hour)
+		}
+	})
+}
+
+// 删除超过保留时间的录像
+func (mgr *ReplayMgr) cleanup() {
+	files, err := ioutil.ReadDir(mgr.dir)
+	if err != nil {
+		log.Error("ReplayMgr cleanup failed: %v", err)
+		return
+	}
+
+	expire := time.Now().Add(-mgr.keep)
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), replaySuffix) && f.ModTime().Before(expire) {
+			if err := os.Remove(filepath.Join(mgr.dir, f.Name())); err != nil {
+				log.Error("ReplayMgr remove %v failed: %v", f.Name(), err)
+			}
+		}
+	}
+}
+
+func (mgr *ReplayMgr) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", ErrInvalidReplay
+	}
+	return filepath.Join(mgr.dir, id+replaySuffix), nil
+}
+
+// 开始录像, 写入录像头
+func (mgr *ReplayMgr) create(room *Room) (*Recorder, error) {
+	id := fmt.Sprintf("%v-%v-%v", room.Id, room.now.Format("20060102150405"), room.frame)
+	path, err := mgr.path(id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		Id:    id,
+		start: room.now,
+		file:  file,
+		gz:    gzip.NewWriter(file),
+	}
+	header := &ReplayHeader{
+		Id:     id,
+		RoomId: room.Id,
+		Kind:   room.Kind,
+		Start:  room.now.UnixNano() / int64(time.Millisecond),
+		Frame:  room.frame,
+		Seed:   room.seed,
+		Seats:  make([]string, len(room.seats)),
+	}
+	for i, seat := range room.seats {
+		if seat != nil {
+			header.Seats[i] = seat.Name
+		}
+	}
+	r.write(&ReplayRecord{Frame: room.frame, Type: REPLAY_START, Header: header})
+
+	return r, nil
+}
+
+func (mgr *ReplayMgr) Load(id string) ([]*ReplayRecord, error) {
+	path, err := mgr.path(id)
+	if err != nil {
+		return nil, err
+	}
+	return readReplay(path)
+}
+
+// 读取录像文件, 第一条必须是开局记录, 崩溃时未写完的最后一行被忽略
+func readReplay(path string) ([]*ReplayRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	records := []*ReplayRecord{}
+	reader := bufio.NewReader(gz)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			rec := &ReplayRecord{}
+			if err := json.Unmarshal(line, rec); err != nil {
+				return nil, err
+			}
+			records = append(records, rec)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(records) == 0 || records[0].Type != REPLAY_START || records[0].Header == nil {
+		return nil, ErrInvalidReplay
+	}
+	return records, nil
+}
+
+// 以下两个方法只在房间 goroutine 中调用
+
+func (room *Room) startRecord() {
+	if !room.recording {
+		return
+	}
+	r, err := replayMgr.create(room)
+	if err != nil {
+		log.Error("Room %v start record failed: %v", room.Id, err)
+		return
+	}
+	room.recorder = r
+}
+
+// 结束录像, 回放时保留收集的推送
+func (room *Room) stopRecord() {
+	if room.recorder == nil {
+		return
+	}
+	room.record(REPLAY_END, "", 0, nil)
+	room.recorder.close()
+	if !room.replaying {
+		room.recorder = nil
+	}
+}
+
+func (room *Room) record(typ string, name string, cmd uint32, data []byte) {
+	if room.recorder == nil {
+		return
+	}
+	room.recorder.write(&ReplayRecord{
+		T:     int64(room.now.Sub(room.recorder.start) / time.Millisecond),
+		Frame: room.frame,
+		Type:  typ,
+		Name:  name,
+		Cmd:   cmd,
+		Data:  string(data),
+	})
+}
+
+// 回放录像: 按录像中的帧号把玩家消息和掉线重连重新交给游戏逻辑, 输出重现的逻辑推送,
+// 并与录像中的逻辑推送逐条比对, 全部一致时返回 nil
+func runReplay(path string, w io.Writer) error {
+	records, err := readReplay(path)
+	if err != nil {
+		return err
+	}
+	header := records[0].Header
+
+	logic, cfg, err := newGameLogic(header.Kind)
+	if err != nil {
+		return err
+	}
+
+	start := time.Unix(0, header.Start*int64(time.Millisecond))
+	room := makeRoom(header.RoomId, header.Kind, len(header.Seats), nil, logic, cfg)
+	room.replaying = true
+	room.frame = header.Frame
+	room.seed = header.Seed
+	room.now = start
+	for i, name := range header.Seats {
+		if name != "" {
+			room.seats[i] = &Seat{Name: name, Ready: true, replayOnline: true}
+		}
+	}
+	room.updateSnapshot()
+	room.logic.OnCreate(room)
+	for _, name := range room.Players() {
+		room.logic.OnJoin(room, name)
+	}
+	room.recorder = &Recorder{Id: header.Id, start: start}
+	room.start()
+
+	var (
+		inputs   = 0
+		recorded = []*ReplayRecord{}
+	)
+	for _, rec := range records[1:] {
+		if rec.Type == REPLAY_OUT {
+			if isLogicCmd(rec.Cmd) {
+				recorded = append(recorded, rec)
+			}
+			continue
+		}
+
+		// 固定帧率房间的消息在该帧的 update 中处理, 需在前一帧放入 inbox
+		frame := rec.Frame
+		if rec.Type == REPLAY_IN && room.fixed {
+			frame--
+		}
+		for room.frame < frame {
+			room.update(start.Add(time.Duration(room.frame+1-header.Frame) * room.tick))
+		}
+		room.now = start.Add(time.Duration(rec.T) * time.Millisecond)
+
+		switch rec.Type {
+		case REPLAY_IN:
+			room.message(rec.Name, []byte(rec.Data))
+		case REPLAY_OFFLINE:
+			room.offline(rec.Name, nil)
+		case REPLAY_ONLINE:
+			if i := room.seatOf(rec.Name); i >= 0 {
+				room.reconnected(room.seats[i])
+			}
+		case REPLAY_FORFEIT:
+			if i := room.seatOf(rec.Name); i >= 0 {
+				room.holdExpired(room.seats[i])
+			}
+		}
+		if rec.Type != REPLAY_END {
+			inputs++
+		}
+	}
+
+	replayed := []*ReplayRecord{}
+	for _, rec := range room.recorder.outs {
+		if isLogicCmd(rec.Cmd) {
+			replayed = append(replayed, rec)
+			fmt.Fprintf(w, "[%v] %v -> '%v' %v: %v\n", rec.Frame, rec.T, rec.Name, rec.Cmd, rec.Data)
+		}
+	}
+
+	mismatch := 0
+	for i := 0; i < len(recorded) || i < len(replayed); i++ {
+		if i >= len(recorded) || i >= len(replayed) || !sameOut(recorded[i], replayed[i]) {
+			if mismatch < 10 {
+				fmt.Fprintf(w, "mismatch #%v:\n  recorded: %v\n  replayed: %v\n", i, describeOut(recorded, i), describeOut(replayed, i))
+			}
+			mismatch++
+		}
+	}
+
+	fmt.Fprintf(w, "replay %v, kind: %v, seats: %v, seed: %v, inputs: %v, outputs: %v/%v, mismatch: %v\n",
+		header.Id, header.Kind, header.Seats, header.Seed, inputs, len(replayed), len(recorded), mismatch)
+	if state := room.logicState(); state != nil {
+		data, _ := json.Marshal(state)
+		fmt.Fprintf(w, "final state: %v\n", string(data))
+	}
+
+	if mismatch > 0 {
+		return fmt.Errorf("replay mismatch: %v", mismatch)
+	}
+	return nil
+}
+
+// 只比对游戏逻辑产生的推送, 房间事件中的在线状态等与回放环境有关
+func isLogicCmd(cmd uint32) bool {
+	return cmd == proto.CMD_GAME_LOGIC_NOTIFY || cmd == proto.CMD_GAME_STATE_NOTIFY
+}
+
+func sameOut(a *ReplayRecord, b *ReplayRecord) bool {
+	return a.Frame == b.Frame && a.Name == b.Name && a.Cmd == b.Cmd && a.Data == b.Data
+}
+
+func describeOut(list []*ReplayRecord, i int) string {
+	if i >= len(list) {
+		return "<none>"
+	}
+	return fmt.Sprintf("[%v] '%v' %v: %v", list[i].Frame, list[i].Name, list[i].Cmd, list[i].Data)
+}
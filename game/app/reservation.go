@@ -0,0 +1,185 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"sync"
+	"time"
+)
+
+var (
+	reservationMgr = &ReservationMgr{
+		tickets: map[string]*Reservation{},
+	}
+)
+
+// 大厅匹配成功后经中心服务器预留的房间座位, 玩家凭票据进入; Spectate 为 true 时为观战票据
+type Reservation struct {
+	RoomId   string
+	Kind     string
+	Name     string
+	Players  []string
+	Expire   time.Time
+	Used     bool // 已使用的票据在玩家在线时无效, 掉线后 ReconnectHold 内可用于重连
+	Spectate bool
+}
+
+type ReservationMgr struct {
+	sync.Mutex
+	tickets map[string]*Reservation
+}
+
+func (mgr *ReservationMgr) Add(notify *proto.CenterReserveRoomNotify) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	expire := time.Unix(notify.Expire, 0)
+	for name, ticket := range notify.Tickets {
+		mgr.tickets[ticket] = &Reservation{
+			RoomId:   notify.RoomId,
+			Kind:     notify.Kind,
+			Name:     name,
+			Players:  notify.Players,
+			Expire:   expire,
+			Spectate: notify.Spectate,
+		}
+	}
+}
+
+// 获取未过期的预留信息
+func (mgr *ReservationMgr) Get(ticket string) (*Reservation, bool) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	r, ok := mgr.tickets[ticket]
+	if !ok || time.Now().After(r.Expire) {
+		return nil, false
+	}
+	return r, true
+}
+
+// 标记票据已使用, 玩家在线期间其他连接不能再用该票据登录
+func (mgr *ReservationMgr) Use(ticket string) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if r, ok := mgr.tickets[ticket]; ok {
+		r.Used = true
+		r.Expire = time.Now()
+	}
+}
+
+// 玩家掉线, 已使用的票据在 hold 时间内可用于重连
+func (mgr *ReservationMgr) Reopen(roomId string, name string, hold time.Duration) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	expire := time.Now().Add(hold)
+	for _, r := range mgr.tickets {
+		if r.RoomId == roomId && r.Name == name && r.Used && !r.Spectate {
+			r.Expire = expire
+		}
+	}
+}
+
+// 房间关闭时删除房间的所有票据
+func (mgr *ReservationMgr) RemoveRoom(roomId string) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	for ticket, r := range mgr.tickets {
+		if r.RoomId == roomId {
+			delete(mgr.tickets, ticket)
+		}
+	}
+}
+
+// 房间中玩家已使用的票据, 用于房间快照
+func (mgr *ReservationMgr) RoomTickets(roomId string) map[string]*Reservation {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	tickets := map[string]*Reservation{}
+	for ticket, r := range mgr.tickets {
+		if r.RoomId == roomId && r.Used && !r.Spectate {
+			tickets[ticket] = r
+		}
+	}
+	return tickets
+}
+
+// 从房间快照恢复票据, 恢复的房间中玩家都视为掉线, 票据在 hold 时间内可用于重连
+func (mgr *ReservationMgr) Restore(tickets map[string]*Reservation, hold time.Duration) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	expire := time.Now().Add(hold)
+	for ticket, r := range tickets {
+		r.Used = true
+		r.Expire = expire
+		mgr.tickets[ticket] = r
+	}
+}
+
+func (mgr *ReservationMgr) clearExpired() {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	now := time.Now()
+	for ticket, r := range mgr.tickets {
+		if !r.Used && now.After(r.Expire) { // 已使用的票据保留到房间关闭, 掉线时重新生效
+			delete(mgr.tickets, ticket)
+		}
+	}
+}
+
+func (mgr *ReservationMgr) run() {
+	util.Go(func() {
+		for {
+			time.Sleep(time.Second * 10)
+			mgr.clearExpired()
+		}
+	})
+}
+
+func onReserveRoomNotify(client *net.TcpClient, msg net.IMessage) {
+	var (
+		notify = &proto.CenterReserveRoomNotify{}
+	)
+
+	err := proto.Unmarshal(msg.Body(), notify)
+	if err != nil {
+		log.Error("onReserveRoomNotify bind failed: %v", err)
+		return
+	}
+
+	// 观战不创建房间, 按房间 ID 或被观战玩家找到已有房间
+	if notify.Spectate {
+		if notify.RoomId == "" {
+			if room, ok := roomMgr.UserRoom(notify.Target); ok {
+				notify.RoomId = room.Id
+			}
+		}
+		if _, ok := roomMgr.Get(notify.RoomId); !ok {
+			log.Error("onReserveRoomNotify spectate %v failed: room of '%v' not exist", notify.RoomId, notify.Target)
+			return
+		}
+		reservationMgr.Add(notify)
+
+		log.Info("onReserveRoomNotify spectate %v, spectators: %v", notify.RoomId, notify.Players)
+		return
+	}
+
+	room, err := roomMgr.Create(notify.RoomId, notify.Kind, len(notify.Players), notify.Players)
+	if err != nil {
+		log.Error("onReserveRoomNotify %v create room failed: %v", notify.RoomId, err)
+		return
+	}
+	room.closeAfter(time.Until(time.Unix(notify.Expire, 0)))
+
+	reservationMgr.Add(notify)
+
+	log.Info("onReserveRoomNotify %v, kind: %v, players: %v", notify.RoomId, notify.Kind, notify.Players)
+}
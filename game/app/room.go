@@ -0,0 +1,1098 @@
+package app
+
+import (
+	"errors"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	roomQueueSize = 256
+	roomInboxMax  = 1024 // 固定帧率房间每帧缓存的玩家消息上限
+	clientSeedMax = 64   // 客户端种子最大长度
+	roomCatchUp   = 5    // 落后时一次最多补跑的帧数, 超出的帧丢弃并计入统计
+)
+
+var (
+	ErrRoomNotExist  = errors.New("room not exist")
+	ErrRoomClosed    = errors.New("room closed")
+	ErrRoomFull      = errors.New("room full")
+	ErrRoomPlaying   = errors.New("game in progress")
+	ErrRoomPrivate   = errors.New("room reserved for other players")
+	ErrNotInRoom     = errors.New("not in room")
+	ErrAlreadyInRoom = errors.New("already in another room")
+	ErrInvalidRoom   = errors.New("invalid room params")
+	ErrRoomBusy      = errors.New("room busy")
+	ErrSpectatorFull = errors.New("too many spectators")
+	ErrNotWatching   = errors.New("not watching")
+	ErrRoomSettled   = errors.New("round already settled")
+	ErrClientSeed    = errors.New("client seed too long")
+	ErrRoomPanic     = errors.New("room operation panic")
+
+	tickStats = &TickStats{}
+)
+
+type Seat struct {
+	Name   string
+	Client *net.TcpClient
+	Ready  bool
+
+	hold         *time.Timer // 游戏中掉线后保留座位的定时器
+	held         bool        // 掉线后在保留期内, 回放时没有定时器, 用于判断何时恢复暂停
+	replayOnline bool        // 回放时没有连接, 用于代替 Client 表示是否在线
+	bot          BotStrategy // 机器人的策略, 真人玩家为 nil
+	clientSeed   string      // 准备时提交的客户端种子, 一局结束后清除
+}
+
+func (seat *Seat) online() bool {
+	return seat.Client != nil || seat.replayOnline || seat.bot != nil
+}
+
+// 观战者, 不占座位, 只接收房间推送
+type Spectator struct {
+	Name   string
+	Client *net.TcpClient
+
+	since uint64 // 加入时的观战消息序号, 只接收之后的消息
+}
+
+// 延迟下发给观战者的消息, to 为空时发给所有观战者
+type spectatorMsg struct {
+	seq uint64
+	at  time.Time
+	msg net.IMessage
+	to  *Spectator
+}
+
+// 房间, 状态只在房间自己的 goroutine 中读写, 外部通过 post/call 投递操作
+type Room struct {
+	Id         string
+	Kind       string
+	capacity   int
+	owner      string
+	state      int
+	seats      []*Seat  // 长度为 capacity, nil 为空座位
+	reserved   []string // 预留给匹配玩家的名单, 非空时只允许名单内的玩家加入
+	logic      GameLogic
+	tick       time.Duration
+	fixed      bool // 固定帧率
+	frame      int64
+	inbox      []*roomMessage
+	lastState  map[string]string // 上一帧广播的状态, 用于计算变化
+	timers     *TimerWheel
+	paused     bool // 暂停时不推进定时器也不调用 OnTick
+	startAt    time.Time
+	now        time.Time // 当前操作的时间, 回放时为录像中的时间
+	rng        *rand.Rand
+	rngSource  *countingSource
+	seed       int64
+	fair       *proto.FairSeed // 下一局或本局的随机数种子, 开局前公布承诺, 结束时公布
+	recording  bool            // 是否录像
+	recorder   *Recorder       // 当前局的录像, 只在游戏中存在
+	replaying  bool            // 回放中, 没有网络连接, 不提交结算
+	snapshotAt time.Time       // 上次保存快照的时间
+	settled    bool            // 本局结算已写入账本, 不再保存快照
+
+	botWait    time.Duration // 有空座位时等待多久用机器人补满, 0 为不补
+	botSettle  bool          // 结算是否包含机器人
+	botCreator BotStrategyCreator
+	botTimer   *time.Timer
+	botInbox   []*botMessage
+
+	spectators     map[string]*Spectator
+	spectatorDelay time.Duration
+	spectatorSeq   uint64
+	delayed        []*spectatorMsg
+
+	ops      chan func()
+	done     chan struct{}
+	snapshot atomic.Value // *proto.RoomInfo, 供房间列表等外部读取
+}
+
+type roomMessage struct {
+	name string
+	data []byte
+}
+
+func makeRoom(id string, kind string, capacity int, reserved []string, logic GameLogic, cfg *KindConfig) *Room {
+	return &Room{
+		Id:             id,
+		Kind:           kind,
+		capacity:       capacity,
+		state:          proto.ROOM_STATE_WAITING,
+		seats:          make([]*Seat, capacity),
+		reserved:       reserved,
+		logic:          logic,
+		tick:           cfg.tick(),
+		fixed:          cfg.Hz > 0,
+		lastState:      map[string]string{},
+		timers:         newTimerWheel(),
+		now:            time.Now(),
+		rng:            rand.New(rand.NewSource(newSeed())),
+		recording:      cfg.Record,
+		botWait:        cfg.botWait(),
+		botSettle:      cfg.BotSettle,
+		botCreator:     botCreators[cfg.logicName(kind)],
+		spectators:     map[string]*Spectator{},
+		spectatorDelay: cfg.spectatorDelay(),
+		ops:            make(chan func(), roomQueueSize),
+		done:           make(chan struct{}),
+	}
+}
+
+func newRoom(id string, kind string, capacity int, reserved []string, logic GameLogic, cfg *KindConfig) *Room {
+	room := makeRoom(id, kind, capacity, reserved, logic, cfg)
+	room.updateSnapshot()
+	room.post(func() {
+		room.logic.OnCreate(room)
+		room.commitSeed()
+	})
+
+	util.Go(room.loop)
+
+	return room
+}
+
+// 帧号按启动后经过的时间计算, ticker 丢失的帧在下次触发时补跑, 落后太多时丢弃并上报
+func (room *Room) loop() {
+	ticker := time.NewTicker(room.tick)
+	defer ticker.Stop()
+
+	base, frames := time.Now(), int64(0)
+	for {
+		select {
+		case f := <-room.ops:
+			room.exec(f)
+		case now := <-ticker.C:
+			room.exec(func() {
+				due := int64(now.Sub(base) / room.tick)
+				if lag := due - frames; lag > roomCatchUp {
+					tickStats.drop(lag - roomCatchUp)
+					log.Warn("Room %v frame %v dropped %v frames", room.Id, room.frame, lag-roomCatchUp)
+					frames = due - roomCatchUp
+				}
+				for frames < due {
+					frames++
+					room.update(base.Add(room.tick * time.Duration(frames)))
+				}
+			})
+		case <-room.done:
+			return
+		}
+	}
+}
+
+func (room *Room) exec(f func()) {
+	defer util.HandlePanic()
+	room.now = time.Now()
+	f()
+	room.flushBots()
+}
+
+// 投递操作到房间 goroutine, 房间已关闭时返回 false
+func (room *Room) post(f func()) bool {
+	select {
+	case room.ops <- f:
+		return true
+	case <-room.done:
+		return false
+	}
+}
+
+// 在房间 goroutine 中执行 f 并等待完成, f 中 panic 时返回 ErrRoomPanic, panic 继续交给 exec 处理
+func (room *Room) call(f func() error) error {
+	errCh := make(chan error, 1)
+	if !room.post(func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- ErrRoomPanic
+				panic(r)
+			}
+		}()
+		errCh <- f()
+	}) {
+		return ErrRoomClosed
+	}
+	select {
+	case err := <-errCh:
+		return err
+	case <-room.done:
+		return ErrRoomClosed
+	}
+}
+
+// 以下方法只在房间 goroutine 中调用, 导出的方法供游戏逻辑使用
+
+// 一帧: 处理缓存的玩家消息, 推进定时器, 调用 OnTick, 广播状态变化, 下发到期的观战消息, 定时保存快照, 并统计超时
+func (room *Room) update(now time.Time) {
+	start := time.Now()
+	room.now = now
+	room.frame++
+
+	if room.fixed {
+		inbox := room.inbox
+		room.inbox = nil
+		for _, m := range inbox {
+			if room.seatOf(m.name) >= 0 {
+				room.record(REPLAY_IN, m.name, 0, m.data)
+				room.logic.OnMessage(room, m.name, m.data)
+			}
+		}
+	}
+
+	if !room.paused {
+		room.timers.Advance()
+		room.logic.OnTick(room, now)
+	}
+
+	if room.fixed {
+		room.broadcastDelta()
+	}
+
+	room.flushSpectators(now)
+
+	if room.replaying {
+		return
+	}
+	if room.state == proto.ROOM_STATE_PLAYING && now.Sub(room.snapshotAt) >= snapshotMgr.interval {
+		room.saveSnapshot()
+	}
+	if cost := time.Since(start); cost > room.tick {
+		tickStats.overrun(cost)
+		log.Warn("Room %v frame %v overrun: %v > %v", room.Id, room.frame, cost, room.tick)
+	}
+}
+
+func (room *Room) Paused() bool {
+	return room.paused
+}
+
+func (room *Room) setPaused(paused bool) {
+	if room.paused == paused {
+		return
+	}
+	room.paused = paused
+	if paused {
+		room.event(proto.ROOM_EVENT_PAUSED, "")
+	} else {
+		room.event(proto.ROOM_EVENT_RESUMED, "")
+	}
+}
+
+// 当前帧号
+func (room *Room) Frame() int64 {
+	return room.frame
+}
+
+// 当前时间, 游戏逻辑应使用 Now 和 Rand 代替 time.Now 和全局随机数, 以便回放时重现
+func (room *Room) Now() time.Time {
+	return room.now
+}
+
+// 房间的随机数, 每局开始时重新设置种子并记录到录像
+func (room *Room) Rand() *rand.Rand {
+	return room.rng
+}
+
+// d 后在房间 goroutine 中执行 f, 精度为一帧, 返回定时器 ID
+func (room *Room) After(d time.Duration, f func()) int64 {
+	return room.timers.After(int((d+room.tick-1)/room.tick), f)
+}
+
+func (room *Room) CancelTimer(id int64) {
+	room.timers.Cancel(id)
+}
+
+func (room *Room) logicState() map[string]interface{} {
+	if sl, ok := room.logic.(StateLogic); ok {
+		return sl.State(room)
+	}
+	return nil
+}
+
+// 广播与上一帧相比变化的状态
+func (room *Room) broadcastDelta() {
+	state := room.logicState()
+	if state == nil {
+		return
+	}
+
+	notify := &proto.GameStateNotify{Frame: room.frame}
+	for key, v := range state {
+		data, err := json.Marshal(v)
+		if err != nil {
+			log.Error("Room %v state %v Marshal failed: %v", room.Id, key, err)
+			continue
+		}
+		if room.lastState[key] != string(data) {
+			if notify.Changed == nil {
+				notify.Changed = map[string]interface{}{}
+			}
+			notify.Changed[key] = v
+			room.lastState[key] = string(data)
+		}
+	}
+	for key := range room.lastState {
+		if _, ok := state[key]; !ok {
+			notify.Removed = append(notify.Removed, key)
+			delete(room.lastState, key)
+		}
+	}
+
+	if len(notify.Changed) > 0 || len(notify.Removed) > 0 {
+		room.broadcast(proto.CMD_GAME_STATE_NOTIFY, notify)
+	}
+}
+
+func (room *Room) State() int {
+	return room.state
+}
+
+// 按座位顺序返回房间内的玩家
+func (room *Room) Players() []string {
+	players := []string{}
+	for _, seat := range room.seats {
+		if seat != nil {
+			players = append(players, seat.Name)
+		}
+	}
+	return players
+}
+
+// 推送游戏逻辑消息给玩家
+func (room *Room) Send(name string, v interface{}) {
+	if i := room.seatOf(name); i >= 0 {
+		room.send(room.seats[i], proto.CMD_GAME_LOGIC_NOTIFY, v)
+	}
+}
+
+func (room *Room) send(seat *Seat, cmd uint32, v interface{}) {
+	msg := proto.NewMessage(cmd, v)
+	room.record(REPLAY_OUT, seat.Name, cmd, msg.Body())
+	if seat.Client != nil {
+		seat.Client.SendMsg(msg)
+	}
+	room.notifyBot(seat, cmd, v)
+}
+
+// 推送游戏逻辑消息给房间内所有玩家, 经 SpectatorLogic 过滤后推送给观战者
+func (room *Room) Broadcast(v interface{}) {
+	room.broadcast(proto.CMD_GAME_LOGIC_NOTIFY, v)
+}
+
+// 推送游戏逻辑消息给观战者
+func (room *Room) SendSpectator(name string, v interface{}) {
+	if spec, ok := room.spectators[name]; ok {
+		room.toSpectators(proto.NewMessage(proto.CMD_GAME_LOGIC_NOTIFY, v), spec)
+	}
+}
+
+// 只推送游戏逻辑消息给所有观战者, 用于下发单独发给玩家的消息的公开部分
+func (room *Room) BroadcastSpectators(v interface{}) {
+	room.toSpectators(proto.NewMessage(proto.CMD_GAME_LOGIC_NOTIFY, v), nil)
+}
+
+// 观战者可见的消息, 游戏逻辑推送经 SpectatorView 过滤, 状态推送只保留可见的 key
+func (room *Room) spectatorView(cmd uint32, v interface{}) (interface{}, bool) {
+	sl, ok := room.logic.(SpectatorLogic)
+	if !ok {
+		return v, true
+	}
+
+	switch cmd {
+	case proto.CMD_GAME_LOGIC_NOTIFY:
+		return sl.SpectatorView(room, v)
+	case proto.CMD_GAME_STATE_NOTIFY:
+		notify := v.(*proto.GameStateNotify)
+		view := &proto.GameStateNotify{
+			Frame:   notify.Frame,
+			Full:    notify.Full,
+			Changed: room.spectatorState(notify.Changed),
+		}
+		for _, key := range notify.Removed {
+			if sl.SpectatorState(room, key) {
+				view.Removed = append(view.Removed, key)
+			}
+		}
+		return view, view.Full || len(view.Changed) > 0 || len(view.Removed) > 0
+	}
+	return v, true
+}
+
+func (room *Room) spectatorState(state map[string]interface{}) map[string]interface{} {
+	sl, ok := room.logic.(SpectatorLogic)
+	if !ok {
+		return state
+	}
+
+	view := map[string]interface{}{}
+	for key, v := range state {
+		if sl.SpectatorState(room, key) {
+			view[key] = v
+		}
+	}
+	return view
+}
+
+// 发送消息给观战者, 配置了观战延迟时加入队列, 到期后在帧循环中下发
+func (room *Room) toSpectators(msg net.IMessage, to *Spectator) {
+	if to == nil && len(room.spectators) == 0 {
+		return
+	}
+
+	if room.spectatorDelay <= 0 {
+		if to != nil {
+			to.Client.SendMsg(msg)
+			return
+		}
+		for _, spec := range room.spectators {
+			spec.Client.SendMsg(msg)
+		}
+		return
+	}
+
+	room.spectatorSeq++
+	room.delayed = append(room.delayed, &spectatorMsg{
+		seq: room.spectatorSeq,
+		at:  time.Now().Add(room.spectatorDelay),
+		msg: msg,
+		to:  to,
+	})
+}
+
+// 下发到期的延迟消息, 只发给消息产生前已加入的观战者
+func (room *Room) flushSpectators(now time.Time) {
+	n := 0
+	for ; n < len(room.delayed) && !room.delayed[n].at.After(now); n++ {
+		m := room.delayed[n]
+		room.delayed[n] = nil
+		if m.to != nil {
+			if room.spectators[m.to.Name] == m.to {
+				m.to.Client.SendMsg(m.msg)
+			}
+			continue
+		}
+		for _, spec := range room.spectators {
+			if spec.since < m.seq {
+				spec.Client.SendMsg(m.msg)
+			}
+		}
+	}
+	room.delayed = room.delayed[n:]
+}
+
+func (room *Room) info() *proto.RoomInfo {
+	info := &proto.RoomInfo{
+		Id:         room.Id,
+		Kind:       room.Kind,
+		Owner:      room.owner,
+		Capacity:   room.capacity,
+		State:      room.state,
+		Paused:     room.paused,
+		Private:    len(room.reserved) > 0,
+		Seats:      make([]*proto.RoomSeat, room.capacity),
+		Spectators: len(room.spectators),
+	}
+	for i, seat := range room.seats {
+		info.Seats[i] = &proto.RoomSeat{Seat: i}
+		if seat != nil {
+			info.Seats[i].Name = seat.Name
+			info.Seats[i].Ready = seat.Ready
+			info.Seats[i].Online = seat.Client != nil || seat.bot != nil
+			info.Seats[i].Bot = seat.bot != nil
+		}
+	}
+	return info
+}
+
+func (room *Room) updateSnapshot() {
+	room.snapshot.Store(room.info())
+}
+
+func (room *Room) Snapshot() *proto.RoomInfo {
+	return room.snapshot.Load().(*proto.RoomInfo)
+}
+
+func (room *Room) seatOf(name string) int {
+	for i, seat := range room.seats {
+		if seat != nil && seat.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (room *Room) count() int {
+	n := 0
+	for _, seat := range room.seats {
+		if seat != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (room *Room) broadcast(cmd uint32, v interface{}) {
+	msg := proto.NewMessage(cmd, v)
+	room.record(REPLAY_OUT, "", cmd, msg.Body())
+	for _, seat := range room.seats {
+		if seat != nil && seat.Client != nil {
+			seat.Client.SendMsg(msg)
+		}
+	}
+	for _, seat := range room.seats {
+		if seat != nil {
+			room.notifyBot(seat, cmd, v)
+		}
+	}
+
+	if len(room.spectators) == 0 {
+		return
+	}
+	if view, ok := room.spectatorView(cmd, v); ok {
+		if view != v {
+			msg = proto.NewMessage(cmd, view)
+		}
+		room.toSpectators(msg, nil)
+	}
+}
+
+func (room *Room) event(event int, name string) {
+	room.updateSnapshot()
+	room.broadcast(proto.CMD_GAME_ROOM_EVENT_NOTIFY, &proto.GameRoomEventNotify{
+		Event: event,
+		Name:  name,
+		Room:  room.Snapshot(),
+	})
+}
+
+// 加入房间, onJoin 不为空时在加入成功后、推送房间事件前调用, 用于保证响应先于推送到达
+func (room *Room) join(name string, client *net.TcpClient, onJoin func(seat int, reconnect bool)) (int, error) {
+	if room.state == proto.ROOM_STATE_CLOSED {
+		return -1, ErrRoomClosed
+	}
+
+	// 已在房间中, 更新连接
+	if i := room.seatOf(name); i >= 0 {
+		room.rejoin(i, client, onJoin)
+		return i, nil
+	}
+
+	if room.state == proto.ROOM_STATE_PLAYING {
+		return -1, ErrRoomPlaying
+	}
+	if len(room.reserved) > 0 && indexOf(room.reserved, name) < 0 {
+		return -1, ErrRoomPrivate
+	}
+
+	for i, seat := range room.seats {
+		if seat == nil {
+			room.seats[i] = &Seat{Name: name, Client: client}
+			if room.owner == "" {
+				room.owner = name
+			}
+			room.updateSnapshot()
+			if onJoin != nil {
+				onJoin(i, false)
+			}
+			room.event(proto.ROOM_EVENT_JOINED, name)
+			room.sendFair(room.seats[i])
+			room.logic.OnJoin(room, name)
+			room.armBots()
+			return i, nil
+		}
+	}
+
+	return -1, ErrRoomFull
+}
+
+// 观战, 已在观战时替换旧连接, onWatch 不为空时在加入成功后、下发局面前调用
+func (room *Room) watch(name string, client *net.TcpClient, onWatch func()) error {
+	if room.state == proto.ROOM_STATE_CLOSED {
+		return ErrRoomClosed
+	}
+	if room.seatOf(name) >= 0 {
+		return ErrAlreadyInRoom
+	}
+
+	if old, ok := room.spectators[name]; ok {
+		if old.Client != client {
+			old.Client.Stop()
+		}
+	} else if len(room.spectators) >= roomMgr.spectatorMax {
+		return ErrSpectatorFull
+	}
+
+	spec := &Spectator{Name: name, Client: client, since: room.spectatorSeq}
+	room.spectators[name] = spec
+	roomMgr.watch(name, room.Id)
+	room.updateSnapshot()
+	if onWatch != nil {
+		onWatch()
+	}
+
+	// 当前局面与之后的推送一起延迟下发
+	if room.fair != nil {
+		room.toSpectators(proto.NewMessage(proto.CMD_GAME_FAIR_NOTIFY, room.fairNotify(room.fairStage())), spec)
+	}
+	if state := room.logicState(); state != nil {
+		room.toSpectators(proto.NewMessage(proto.CMD_GAME_STATE_NOTIFY, &proto.GameStateNotify{
+			Frame:   room.frame,
+			Full:    true,
+			Changed: room.spectatorState(state),
+		}), spec)
+	}
+	if sl, ok := room.logic.(SpectatorLogic); ok {
+		sl.OnSpectate(room, name)
+	}
+	room.event(proto.ROOM_EVENT_WATCHED, name)
+
+	return nil
+}
+
+// 结束观战, client 不为空时只移除该连接的观战者
+func (room *Room) unwatch(name string, client *net.TcpClient) error {
+	spec, ok := room.spectators[name]
+	if !ok || (client != nil && spec.Client != client) {
+		return ErrNotWatching
+	}
+
+	delete(room.spectators, name)
+	roomMgr.unwatch(name, room.Id)
+	room.event(proto.ROOM_EVENT_UNWATCHED, name)
+
+	return nil
+}
+
+func (room *Room) leave(name string) error {
+	i := room.seatOf(name)
+	if i < 0 {
+		return ErrNotInRoom
+	}
+	if room.state == proto.ROOM_STATE_PLAYING {
+		return ErrRoomPlaying
+	}
+
+	if room.seats[i].hold != nil {
+		room.seats[i].hold.Stop()
+	}
+	room.seats[i] = nil
+	room.event(proto.ROOM_EVENT_LEFT, name)
+	roomMgr.unbind(name, room.Id)
+	room.logic.OnLeave(room, name)
+
+	// 只剩机器人时关闭房间
+	if room.humans() == 0 {
+		room.close()
+		return nil
+	}
+
+	if room.owner == name {
+		room.owner = ""
+		for _, seat := range room.seats {
+			if seat != nil && seat.bot == nil {
+				room.owner = seat.Name
+				break
+			}
+		}
+		room.event(proto.ROOM_EVENT_OWNER, room.owner)
+	}
+
+	room.armBots()
+
+	return nil
+}
+
+// 掉线: 等待中直接离开, 游戏中保留座位, 由游戏逻辑决定继续、暂停或判负
+func (room *Room) offline(name string, client *net.TcpClient) {
+	i := room.seatOf(name)
+	if i < 0 || room.seats[i].Client != client {
+		return
+	}
+	if !room.replaying {
+		reservationMgr.Reopen(room.Id, name, roomMgr.reconnectHold)
+	}
+	if room.state != proto.ROOM_STATE_PLAYING {
+		room.leave(name)
+		return
+	}
+
+	seat := room.seats[i]
+	seat.Client = nil
+	seat.replayOnline = false
+	room.record(REPLAY_OFFLINE, name, 0, nil)
+	room.event(proto.ROOM_EVENT_OFFLINE, name)
+
+	rl, ok := room.logic.(ReconnectLogic)
+	if !ok {
+		return
+	}
+
+	switch rl.OnOffline(room, name) {
+	case OFFLINE_PAUSE:
+		room.setPaused(true)
+	case OFFLINE_FORFEIT:
+		rl.OnForfeit(room, name)
+		return
+	}
+	seat.held = true
+	if room.replaying {
+		return
+	}
+
+	room.holdSeat(seat)
+}
+
+// 保留掉线玩家的座位 ReconnectHold 时间
+func (room *Room) holdSeat(seat *Seat) {
+	seat.held = true
+	seat.hold = time.AfterFunc(roomMgr.reconnectHold, func() {
+		room.post(func() {
+			room.holdExpired(seat)
+		})
+	})
+}
+
+// 保留座位到期仍未重连, 交给游戏逻辑判负, 其他座位都不在保留期内时恢复暂停的游戏
+func (room *Room) holdExpired(seat *Seat) {
+	if i := room.seatOf(seat.Name); i < 0 || room.seats[i] != seat || seat.online() {
+		return
+	}
+	seat.hold = nil
+	seat.held = false
+	if room.state != proto.ROOM_STATE_PLAYING {
+		return
+	}
+	room.record(REPLAY_FORFEIT, seat.Name, 0, nil)
+
+	log.Info("Room %v %v reconnect timeout", room.Id, seat.Name)
+
+	if !room.holding() {
+		room.setPaused(false)
+	}
+	if rl, ok := room.logic.(ReconnectLogic); ok {
+		rl.OnForfeit(room, seat.Name)
+	}
+}
+
+// 是否还有掉线玩家在保留座位期内, 已判负的座位不计
+func (room *Room) holding() bool {
+	for _, seat := range room.seats {
+		if seat != nil && seat.held {
+			return true
+		}
+	}
+	return false
+}
+
+// 已在房间中的玩家重新加入, 替换旧连接, 游戏中掉线重连时下发完整状态
+func (room *Room) rejoin(i int, client *net.TcpClient, onJoin func(seat int, reconnect bool)) {
+	var (
+		seat      = room.seats[i]
+		old       = seat.Client
+		reconnect = old == nil && room.state == proto.ROOM_STATE_PLAYING
+	)
+
+	if old != nil && old != client {
+		old.Stop()
+	}
+	if seat.hold != nil {
+		seat.hold.Stop()
+		seat.hold = nil
+	}
+
+	seat.Client = client
+	room.updateSnapshot()
+	if onJoin != nil {
+		onJoin(i, reconnect)
+	}
+	if old == client {
+		return
+	}
+	if !reconnect {
+		room.event(proto.ROOM_EVENT_JOINED, seat.Name)
+		room.sendFair(seat)
+		return
+	}
+
+	room.reconnected(seat)
+}
+
+// 游戏中掉线的玩家重连, 下发完整状态并交给游戏逻辑恢复
+func (room *Room) reconnected(seat *Seat) {
+	seat.held = false
+	seat.replayOnline = room.replaying
+	room.record(REPLAY_ONLINE, seat.Name, 0, nil)
+	room.event(proto.ROOM_EVENT_RECONNECTED, seat.Name)
+	room.sendFair(seat)
+
+	if state := room.logicState(); state != nil {
+		room.send(seat, proto.CMD_GAME_STATE_NOTIFY, &proto.GameStateNotify{
+			Frame:   room.frame,
+			Full:    true,
+			Changed: state,
+		})
+	}
+	if rl, ok := room.logic.(ReconnectLogic); ok {
+		rl.OnReconnect(room, seat.Name)
+	}
+
+	if room.paused && !room.holding() {
+		room.setPaused(false)
+	}
+
+	log.Info("Room %v %v reconnected", room.Id, seat.Name)
+}
+
+// 准备时记录玩家的客户端种子, 开局时用于计算公开种子
+func (room *Room) ready(name string, ready bool, clientSeed string) error {
+	i := room.seatOf(name)
+	if i < 0 {
+		return ErrNotInRoom
+	}
+	if room.state != proto.ROOM_STATE_WAITING {
+		return ErrRoomPlaying
+	}
+	if len(clientSeed) > clientSeedMax {
+		return ErrClientSeed
+	}
+
+	room.seats[i].Ready = ready
+	room.seats[i].clientSeed = clientSeed
+	room.event(proto.ROOM_EVENT_READY, name)
+	room.checkStart()
+
+	return nil
+}
+
+// 坐满且全员准备后开始
+func (room *Room) checkStart() {
+	if room.count() < room.capacity {
+		return
+	}
+	for _, seat := range room.seats {
+		if !seat.Ready {
+			return
+		}
+	}
+	room.start()
+}
+
+func (room *Room) start() {
+	room.state = proto.ROOM_STATE_PLAYING
+	room.startAt = room.now
+	room.snapshotAt = room.now
+	if !room.replaying {
+		room.startSeed()
+		room.seed = room.fair.Seed
+		room.startRecord()
+	}
+	room.settled = false
+	room.rngSource = newCountingSource(room.seed)
+	room.rng = rand.New(room.rngSource)
+	room.event(proto.ROOM_EVENT_STARTED, "")
+	room.logic.OnStart(room)
+	room.saveSnapshot()
+
+	log.Info("Room %v started, kind: %v, players: %v", room.Id, room.Kind, room.Snapshot().Seats)
+}
+
+// 提交本局结算, 由游戏逻辑在调用 End 前调用, results 为 玩家 -> 结算结果, 返回结算 ID;
+// 结算写入本地账本后经中心服务器提交到玩家所在大厅, 写入后删除快照, 崩溃重启不会恢复已结算的一局
+func (room *Room) Settle(results map[string]*proto.SettlementResult) (string, error) {
+	if room.replaying {
+		return "", nil
+	}
+	s := &proto.Settlement{
+		Id:      settlementId(room.Id, room.startAt.UnixNano()/int64(time.Millisecond), room.seed),
+		RoomId:  room.Id,
+		Kind:    room.Kind,
+		Start:   room.startAt.Unix(),
+		End:     room.now.Unix(),
+		Players: room.settleResults(results),
+	}
+	if room.recorder != nil {
+		s.Replay = room.recorder.Id
+	}
+	s.Fair = room.fair
+	id, err := settlementMgr.Settle(s)
+	if err == nil {
+		room.settled = true
+		room.removeSnapshot()
+	}
+	return id, err
+}
+
+// 记录取数次数的随机数源, 快照保存取数次数, 恢复时以同一种子重建并跳过相同次数,
+// 恢复后的随机数序列与未中断时一致; 逻辑不应使用 Rand().Read, 其缓存的字节不会保存
+type countingSource struct {
+	src   rand.Source64
+	draws int64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.src.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.src.Uint64()
+}
+
+func (s *countingSource) Seed(seed int64) {
+	s.draws = 0
+	s.src.Seed(seed)
+}
+
+func (s *countingSource) skip(draws int64) {
+	for s.draws < draws {
+		s.Uint64()
+	}
+}
+
+// 一局结束, 由游戏逻辑调用, 清除准备状态并移除掉线的玩家, 机器人重新准备
+func (room *Room) End() {
+	if room.state != proto.ROOM_STATE_PLAYING {
+		return
+	}
+
+	room.logic.OnEnd(room)
+	room.removeSnapshot()
+
+	room.state = proto.ROOM_STATE_WAITING
+	for _, seat := range room.seats {
+		if seat != nil {
+			seat.Ready = false
+			seat.clientSeed = ""
+		}
+	}
+	room.paused = false
+	room.event(proto.ROOM_EVENT_ENDED, "")
+	room.revealSeed()
+	room.stopRecord()
+
+	log.Info("Room %v ended", room.Id)
+
+	for _, seat := range room.seats {
+		if seat != nil && !seat.online() {
+			room.leave(seat.Name)
+		}
+	}
+	if room.state == proto.ROOM_STATE_WAITING {
+		room.commitSeed()
+		room.readyBots()
+		room.armBots()
+	}
+}
+
+func (room *Room) close() {
+	if room.state == proto.ROOM_STATE_CLOSED {
+		return
+	}
+
+	room.state = proto.ROOM_STATE_CLOSED
+	room.stopBots()
+	room.event(proto.ROOM_EVENT_CLOSED, "")
+	room.stopRecord()
+	room.removeSnapshot()
+	for _, seat := range room.seats {
+		if seat != nil {
+			roomMgr.unbind(seat.Name, room.Id)
+		}
+	}
+	// 房间关闭后不再有帧循环, 立即下发所有延迟的观战消息
+	room.flushSpectators(time.Now().Add(room.spectatorDelay))
+	for name := range room.spectators {
+		roomMgr.unwatch(name, room.Id)
+	}
+	roomMgr.remove(room.Id)
+	reservationMgr.RemoveRoom(room.Id)
+	close(room.done)
+
+	log.Info("Room %v closed", room.Id)
+}
+
+// 玩家的游戏逻辑消息
+func (room *Room) message(name string, data []byte) error {
+	if room.seatOf(name) < 0 {
+		return ErrNotInRoom
+	}
+	if !room.fixed {
+		room.record(REPLAY_IN, name, 0, data)
+		room.logic.OnMessage(room, name, data)
+		return nil
+	}
+	if len(room.inbox) >= roomInboxMax {
+		return ErrRoomBusy
+	}
+	room.inbox = append(room.inbox, &roomMessage{name: name, data: data})
+	return nil
+}
+
+// 预留的房间到期时无人加入则关闭
+func (room *Room) closeIfEmpty() {
+	if room.count() == 0 {
+		room.close()
+	}
+}
+
+func (room *Room) closeAfter(d time.Duration) {
+	time.AfterFunc(d, func() {
+		room.post(room.closeIfEmpty)
+	})
+}
+
+func indexOf(list []string, name string) int {
+	for i, v := range list {
+		if v == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 所有房间的帧超时和丢帧统计, 随负载上报后清零
+type TickStats struct {
+	sync.Mutex
+	overruns int
+	dropped  int64
+	maxCost  time.Duration
+}
+
+func (stats *TickStats) overrun(cost time.Duration) {
+	stats.Lock()
+	defer stats.Unlock()
+
+	stats.overruns++
+	if cost > stats.maxCost {
+		stats.maxCost = cost
+	}
+}
+
+func (stats *TickStats) drop(n int64) {
+	stats.Lock()
+	defer stats.Unlock()
+
+	stats.dropped += n
+}
+
+// 返回并清零统计
+func (stats *TickStats) Reset() (overruns int, dropped int64, maxCost time.Duration) {
+	stats.Lock()
+	defer stats.Unlock()
+
+	overruns, dropped, maxCost = stats.overruns, stats.dropped, stats.maxCost
+	stats.overruns, stats.dropped, stats.maxCost = 0, 0, 0
+	return
+}
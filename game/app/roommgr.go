@@ -0,0 +1,296 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/nothollyhigh/kiss/net"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	roomMgr = &RoomMgr{
+		rooms:    map[string]*Room{},
+		users:    map[string]string{},
+		watching: map[string]string{},
+	}
+)
+
+func randomId(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func newSeed() int64 {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return int64(binary.LittleEndian.Uint64(buf))
+}
+
+// 房间管理, 记录所有房间和玩家所在的房间, 一个玩家同时只能在一个房间中
+type RoomMgr struct {
+	sync.RWMutex
+	rooms    map[string]*Room
+	users    map[string]string // 用户名 -> 房间 ID
+	watching map[string]string // 观战者 -> 房间 ID
+
+	capacityMax   int
+	reconnectHold time.Duration
+	spectatorMax  int
+}
+
+func (mgr *RoomMgr) init() {
+	mgr.capacityMax = config.RoomCapacityMax
+	if mgr.capacityMax <= 0 {
+		mgr.capacityMax = 8
+	}
+
+	mgr.reconnectHold = time.Second * time.Duration(config.ReconnectHold)
+	if mgr.reconnectHold <= 0 {
+		mgr.reconnectHold = time.Second * 60
+	}
+
+	mgr.spectatorMax = config.SpectatorMax
+	if mgr.spectatorMax <= 0 {
+		mgr.spectatorMax = 20
+	}
+
+	// 定时上报负载
+	interval := time.Second * time.Duration(config.LoadReport)
+	if interval <= 0 {
+		interval = time.Second * 10
+	}
+	util.Go(func() {
+		for {
+			time.Sleep(interval)
+			updateGameInfo()
+		}
+	})
+}
+
+// 创建房间, id 为空时随机生成, id 已存在时返回已有房间
+func (mgr *RoomMgr) Create(id string, kind string, capacity int, reserved []string) (*Room, error) {
+	if kind == "" || capacity <= 0 {
+		return nil, ErrInvalidRoom
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if id == "" {
+		for id == "" || mgr.rooms[id] != nil {
+			id = randomId(6)
+		}
+	} else if room, ok := mgr.rooms[id]; ok {
+		return room, nil
+	}
+
+	logic, cfg, err := newGameLogic(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	room := newRoom(id, kind, capacity, reserved, logic, cfg)
+	mgr.rooms[id] = room
+
+	return room, nil
+}
+
+func (mgr *RoomMgr) Get(id string) (*Room, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	room, ok := mgr.rooms[id]
+	return room, ok
+}
+
+func (mgr *RoomMgr) remove(id string) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	delete(mgr.rooms, id)
+}
+
+// 获取玩家所在的房间
+func (mgr *RoomMgr) UserRoom(name string) (*Room, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	id, ok := mgr.users[name]
+	if !ok {
+		return nil, false
+	}
+	room, ok := mgr.rooms[id]
+	return room, ok
+}
+
+// 先占用玩家所在房间记录, 保证同时只加入一个房间
+func (mgr *RoomMgr) bind(name string, id string) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if old, ok := mgr.users[name]; ok && old != id {
+		if _, exist := mgr.rooms[old]; exist {
+			return ErrAlreadyInRoom
+		}
+	}
+	mgr.users[name] = id
+	return nil
+}
+
+func (mgr *RoomMgr) unbind(name string, id string) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if mgr.users[name] == id {
+		delete(mgr.users, name)
+	}
+}
+
+// 加入房间, 返回座位号, onJoin 见 Room.join
+func (mgr *RoomMgr) Join(room *Room, name string, client *net.TcpClient, onJoin func(seat int, reconnect bool)) (int, error) {
+	if err := mgr.bind(name, room.Id); err != nil {
+		return -1, err
+	}
+
+	seat := -1
+	err := room.call(func() (err error) {
+		seat, err = room.join(name, client, onJoin)
+		return err
+	})
+	if err != nil {
+		mgr.unbind(name, room.Id)
+	}
+	return seat, err
+}
+
+// 获取观战者所在的房间
+func (mgr *RoomMgr) WatchingRoom(name string) (*Room, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	id, ok := mgr.watching[name]
+	if !ok {
+		return nil, false
+	}
+	room, ok := mgr.rooms[id]
+	return room, ok
+}
+
+// 在房间 goroutine 中记录观战者所在房间
+func (mgr *RoomMgr) watch(name string, id string) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	mgr.watching[name] = id
+}
+
+func (mgr *RoomMgr) unwatch(name string, id string) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if mgr.watching[name] == id {
+		delete(mgr.watching, name)
+	}
+}
+
+// 观战, 同时只能观战一个房间, onWatch 见 Room.watch
+func (mgr *RoomMgr) Watch(room *Room, name string, client *net.TcpClient, onWatch func()) error {
+	if old, ok := mgr.WatchingRoom(name); ok && old != room {
+		old.call(func() error {
+			return old.unwatch(name, nil)
+		})
+	}
+	return room.call(func() error {
+		return room.watch(name, client, onWatch)
+	})
+}
+
+func (mgr *RoomMgr) Unwatch(name string) error {
+	room, ok := mgr.WatchingRoom(name)
+	if !ok {
+		return ErrNotWatching
+	}
+	return room.call(func() error {
+		return room.unwatch(name, nil)
+	})
+}
+
+func (mgr *RoomMgr) Leave(name string) error {
+	room, ok := mgr.UserRoom(name)
+	if !ok {
+		return ErrNotInRoom
+	}
+	return room.call(func() error {
+		return room.leave(name)
+	})
+}
+
+func (mgr *RoomMgr) Ready(name string, ready bool, clientSeed string) error {
+	room, ok := mgr.UserRoom(name)
+	if !ok {
+		return ErrNotInRoom
+	}
+	return room.call(func() error {
+		return room.ready(name, ready, clientSeed)
+	})
+}
+
+// 转发游戏逻辑消息到玩家所在房间
+func (mgr *RoomMgr) Message(name string, data []byte) error {
+	room, ok := mgr.UserRoom(name)
+	if !ok {
+		return ErrNotInRoom
+	}
+	if !room.post(func() {
+		room.message(name, data)
+	}) {
+		return ErrRoomClosed
+	}
+	return nil
+}
+
+// 玩家或观战者断开连接
+func (mgr *RoomMgr) Offline(name string, client *net.TcpClient) {
+	if room, ok := mgr.UserRoom(name); ok {
+		room.post(func() {
+			room.offline(name, client)
+		})
+	}
+	if room, ok := mgr.WatchingRoom(name); ok {
+		room.post(func() {
+			room.unwatch(name, client)
+		})
+	}
+}
+
+// 非预留房间的列表, kind 为空时返回所有类型
+func (mgr *RoomMgr) List(kind string) []*proto.RoomInfo {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	rooms := []*proto.RoomInfo{}
+	for _, room := range mgr.rooms {
+		info := room.Snapshot()
+		if !info.Private && (kind == "" || kind == info.Kind) {
+			rooms = append(rooms, info)
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].Id < rooms[j].Id
+	})
+	return rooms
+}
+
+// 房间数、房间内玩家数和观战人数
+func (mgr *RoomMgr) Load() (rooms int, players int, spectators int) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	return len(mgr.rooms), len(mgr.users), len(mgr.watching)
+}
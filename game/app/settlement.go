@@ -0,0 +1,358 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ledgerFile          = "ledger.jsonl"
+	ledgerArchivePrefix = "ledger-"            // 归档的账本: ledger-时间.jsonl
+	ledgerCompactLines  = 100000               // 启动时账本超过该行数则轮换
+	ledgerSettledKeep   = int64(7 * 24 * 3600) // 已确认结算的 ID 在账本和内存中保留的秒数
+
+	LEDGER_SETTLE  = "settle"  // 结算
+	LEDGER_ACK     = "ack"     // 大厅已处理的玩家
+	LEDGER_SETTLED = "settled" // 轮换时保留的已确认结算 ID, Time 为结算结束时间
+)
+
+var (
+	settlementMgr = &SettlementMgr{
+		pending: map[string]*pendingSettlement{},
+		settled: map[string]int64{},
+	}
+)
+
+// 账本记录, 每行一条 JSON, 只追加不修改
+type LedgerRecord struct {
+	Type       string            `json:"type"`
+	Time       int64             `json:"time"`
+	Settlement *proto.Settlement `json:"settlement,omitempty"`
+	Id         string            `json:"id,omitempty"`
+	Names      []string          `json:"names,omitempty"`
+}
+
+// 还有玩家未被大厅确认的结算
+type pendingSettlement struct {
+	settlement *proto.Settlement
+	unacked    map[string]bool
+}
+
+// 结算管理: 结算先写入本地账本再经中心服务器提交到玩家所在大厅, 大厅按结算 ID 幂等处理,
+// 启动时从账本恢复未确认的结算并定时重新提交, 崩溃重启后重复提交不会重复生效;
+// settled 为最近 ledgerSettledKeep 秒内结算的 ID -> 结束时间, 同一局不会写入两次;
+// 账本只追加, 启动时超过 ledgerCompactLines 行则归档并新建只含未确认结算和最近结算 ID 的账本
+type SettlementMgr struct {
+	sync.Mutex
+	file    *os.File
+	pending map[string]*pendingSettlement
+	settled map[string]int64
+}
+
+func (mgr *SettlementMgr) init() {
+	if err := os.MkdirAll(config.DataDir, 0755); err != nil {
+		log.Panic("SettlementMgr init failed: %v", err)
+	}
+
+	path := filepath.Join(config.DataDir, ledgerFile)
+	lines, err := mgr.load(path)
+	if err != nil {
+		log.Panic("SettlementMgr load %v failed: %v", path, err)
+	}
+	if lines > ledgerCompactLines {
+		if err = mgr.compact(path); err != nil {
+			log.Panic("SettlementMgr compact %v failed: %v", path, err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Panic("SettlementMgr open %v failed: %v", path, err)
+	}
+	mgr.file = file
+
+	log.Info("SettlementMgr init, ledger: %v, pending: %v", path, len(mgr.pending))
+
+	interval := time.Second * time.Duration(config.SettleRetry)
+	if interval <= 0 {
+		interval = time.Second * 30
+	}
+	util.Go(func() {
+		for {
+			time.Sleep(interval)
+			mgr.prune()
+			mgr.Resubmit()
+		}
+	})
+}
+
+// 重放账本, 恢复未确认的结算, 返回行数
+func (mgr *SettlementMgr) load(path string) (int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	line := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line++
+		record := &LedgerRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			// 崩溃时可能写了半行, 忽略
+			log.Warn("SettlementMgr load line %v failed: %v", line, err)
+			continue
+		}
+		switch record.Type {
+		case LEDGER_SETTLE:
+			if record.Settlement != nil {
+				mgr.settled[record.Settlement.Id] = record.Settlement.End
+				mgr.addPending(record.Settlement)
+			}
+		case LEDGER_ACK:
+			mgr.ack(record.Id, record.Names)
+		case LEDGER_SETTLED:
+			mgr.settled[record.Id] = record.Time
+		}
+	}
+	mgr.prune()
+	return line, scanner.Err()
+}
+
+// 轮换账本: 原账本以硬链接归档, 新账本写入临时文件后改名替换, 任何时刻崩溃都保留完整的账本
+func (mgr *SettlementMgr) compact(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriter(file)
+	write := func(record *LedgerRecord) {
+		if data, err := json.Marshal(record); err == nil {
+			w.Write(append(data, '\n'))
+		}
+	}
+	now := time.Now().Unix()
+	for id, p := range mgr.pending {
+		write(&LedgerRecord{Type: LEDGER_SETTLE, Time: now, Settlement: p.settlement})
+		acked := []string{}
+		for name := range p.settlement.Players {
+			if !p.unacked[name] {
+				acked = append(acked, name)
+			}
+		}
+		if len(acked) > 0 {
+			write(&LedgerRecord{Type: LEDGER_ACK, Time: now, Id: id, Names: acked})
+		}
+	}
+	for id, end := range mgr.settled {
+		if _, ok := mgr.pending[id]; !ok {
+			write(&LedgerRecord{Type: LEDGER_SETTLED, Time: end, Id: id})
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	archive := filepath.Join(filepath.Dir(path), ledgerArchivePrefix+time.Now().Format("20060102150405")+".jsonl")
+	if err = os.Link(path, archive); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	log.Info("SettlementMgr compact %v, archive: %v, pending: %v, settled: %v", path, archive, len(mgr.pending), len(mgr.settled))
+	return nil
+}
+
+// 删除超过保留时间且已确认的结算 ID
+func (mgr *SettlementMgr) prune() {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	now := time.Now().Unix()
+	for id, end := range mgr.settled {
+		if _, ok := mgr.pending[id]; !ok && now-end > ledgerSettledKeep {
+			delete(mgr.settled, id)
+		}
+	}
+}
+
+func (mgr *SettlementMgr) addPending(s *proto.Settlement) {
+	p := &pendingSettlement{
+		settlement: s,
+		unacked:    map[string]bool{},
+	}
+	for name := range s.Players {
+		p.unacked[name] = true
+	}
+	if len(p.unacked) > 0 {
+		mgr.pending[s.Id] = p
+	}
+}
+
+func (mgr *SettlementMgr) ack(id string, names []string) bool {
+	p, ok := mgr.pending[id]
+	if !ok {
+		return false
+	}
+	for _, name := range names {
+		delete(p.unacked, name)
+	}
+	if len(p.unacked) == 0 {
+		delete(mgr.pending, id)
+	}
+	return true
+}
+
+// 追加一条记录并落盘
+func (mgr *SettlementMgr) write(record *LedgerRecord) error {
+	record.Time = time.Now().Unix()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = mgr.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return mgr.file.Sync()
+}
+
+// 一局的结算 ID, 由房间、开局时间(Unix 毫秒)和种子得到, 同一局重复结算或从快照恢复后结算得到相同的 ID
+func settlementId(roomId string, startAt int64, seed int64) string {
+	return fmt.Sprintf("%v-%v-%v-%x", config.SvrID, roomId, startAt, uint64(seed))
+}
+
+// 该局的结算是否已写入账本
+func (mgr *SettlementMgr) Settled(id string) bool {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	_, ok := mgr.settled[id]
+	return ok
+}
+
+// 记录结算并提交, 返回结算 ID; 已写入账本的结算不重复记录, 写入账本失败时不提交
+func (mgr *SettlementMgr) Settle(s *proto.Settlement) (string, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	s.Game = config.SvrID
+	if _, ok := mgr.settled[s.Id]; ok {
+		log.Warn("Settle %v already in ledger", s.Id)
+		return s.Id, nil
+	}
+
+	if err := mgr.write(&LedgerRecord{Type: LEDGER_SETTLE, Settlement: s}); err != nil {
+		log.Error("Settle %v write ledger failed: %v", s.Id, err)
+		return "", err
+	}
+	mgr.settled[s.Id] = s.End
+	mgr.addPending(s)
+
+	util.Go(func() {
+		mgr.submit(s)
+	})
+
+	return s.Id, nil
+}
+
+func (mgr *SettlementMgr) submit(s *proto.Settlement) {
+	var (
+		req = &proto.CenterSettleReq{
+			Settlement: s,
+		}
+		rsp = &proto.CenterSettleRsp{}
+	)
+
+	err := centerSession.Call(proto.RPC_METHOD_SETTLE, req, rsp, time.Second*3)
+	if err != nil {
+		log.Error("Settle %v submit failed: %v", s.Id, err)
+		return
+	}
+	if rsp.Code != 0 {
+		log.Error("Settle %v submit failed, code: %v, msg: %v", s.Id, rsp.Code, rsp.Msg)
+	}
+}
+
+// 重新提交所有未确认的结算
+func (mgr *SettlementMgr) Resubmit() {
+	mgr.Lock()
+	list := make([]*proto.Settlement, 0, len(mgr.pending))
+	for _, p := range mgr.pending {
+		list = append(list, p.settlement)
+	}
+	mgr.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].End < list[j].End
+	})
+	for _, s := range list {
+		mgr.submit(s)
+	}
+
+	if len(list) > 0 {
+		log.Info("SettlementMgr resubmit %v settlements", len(list))
+	}
+}
+
+// 大厅确认, 记录到账本
+func (mgr *SettlementMgr) Ack(id string, names []string) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if !mgr.ack(id, names) {
+		return
+	}
+	if err := mgr.write(&LedgerRecord{Type: LEDGER_ACK, Id: id, Names: names}); err != nil {
+		log.Error("Settle %v write ack failed: %v", id, err)
+	}
+}
+
+func (mgr *SettlementMgr) stop() {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if mgr.file != nil {
+		mgr.file.Close()
+	}
+}
+
+func onSettleAckNotify(client *net.TcpClient, msg net.IMessage) {
+	var (
+		notify = &proto.CenterSettleAckReq{}
+	)
+
+	err := proto.Unmarshal(msg.Body(), notify)
+	if err != nil {
+		log.Error("onSettleAckNotify bind failed: %v", err)
+		return
+	}
+
+	settlementMgr.Ack(notify.Id, notify.Names)
+
+	log.Debug("onSettleAckNotify %v, names: %v", notify.Id, notify.Names)
+}
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/util"
+	"io/ioutil"
+	"kisscluster/proto"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotDir    = "snapshot"
+	snapshotSuffix = ".json"
+)
+
+var (
+	snapshotMgr = &SnapshotMgr{}
+)
+
+// 游戏中房间的快照, Seats 为座位上的玩家, 空座位为空字符串, Tickets 为玩家重连用的票据
+type RoomSnapshot struct {
+	Id       string                  `json:"id"`
+	Kind     string                  `json:"kind"`
+	Owner    string                  `json:"owner"`
+	Reserved []string                `json:"reserved"`
+	Seats    []string                `json:"seats"`
+	Bots     []string                `json:"bots,omitempty"`
+	Frame    int64                   `json:"frame"`
+	Seed     int64                   `json:"seed"`
+	Draws    int64                   `json:"draws"` // 本局随机数的取数次数
+	Fair     *proto.FairSeed         `json:"fair,omitempty"`
+	StartAt  int64                   `json:"startAt"` // Unix 毫秒
+	Time     int64                   `json:"time"`    // Unix 毫秒
+	Tickets  map[string]*Reservation `json:"tickets"`
+	Logic    string                  `json:"logic"`
+}
+
+// 房间快照, 保存在 DataDir/snapshot/SvrID 下, 每个房间一个文件, 一局结束或房间关闭时删除
+type SnapshotMgr struct {
+	dir      string
+	interval time.Duration
+}
+
+func (mgr *SnapshotMgr) init() {
+	mgr.dir = filepath.Join(config.DataDir, snapshotDir, config.SvrID)
+	if err := os.MkdirAll(mgr.dir, 0755); err != nil {
+		log.Panic("SnapshotMgr init failed: %v", err)
+	}
+
+	mgr.interval = time.Second * time.Duration(config.SnapshotInterval)
+	if mgr.interval <= 0 {
+		mgr.interval = time.Second * 10
+	}
+}
+
+func (mgr *SnapshotMgr) path(roomId string) string {
+	return filepath.Join(mgr.dir, roomId+snapshotSuffix)
+}
+
+// 先写临时文件再改名, 崩溃时不会留下写了一半的快照
+func (mgr *SnapshotMgr) save(snap *RoomSnapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	path := mgr.path(snap.Id)
+	if err = ioutil.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (mgr *SnapshotMgr) remove(roomId string) {
+	if err := os.Remove(mgr.path(roomId)); err != nil && !os.IsNotExist(err) {
+		log.Error("SnapshotMgr remove %v failed: %v", roomId, err)
+	}
+}
+
+// 启动时恢复上次运行留下的快照
+func (mgr *SnapshotMgr) restore() {
+	files, err := ioutil.ReadDir(mgr.dir)
+	if err != nil {
+		log.Error("SnapshotMgr restore failed: %v", err)
+		return
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), snapshotSuffix) {
+			continue
+		}
+
+		path := filepath.Join(mgr.dir, f.Name())
+		snap := &RoomSnapshot{}
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, snap)
+		}
+		if err == nil {
+			err = roomMgr.Restore(snap)
+		}
+		if err != nil {
+			log.Error("SnapshotMgr restore %v failed: %v", f.Name(), err)
+			os.Remove(path)
+			continue
+		}
+
+		log.Info("SnapshotMgr restore room %v, kind: %v, seats: %v, saved at: %v",
+			snap.Id, snap.Kind, snap.Seats, time.Unix(0, snap.Time*int64(time.Millisecond)))
+	}
+}
+
+// 以下方法只在房间 goroutine 中调用
+
+// 保存游戏中房间的快照, 逻辑未实现 SnapshotLogic 时不保存
+func (room *Room) saveSnapshot() {
+	sl, ok := room.logic.(SnapshotLogic)
+	if !ok || room.replaying || room.settled || room.state != proto.ROOM_STATE_PLAYING {
+		return
+	}
+	room.snapshotAt = room.now
+
+	data, err := sl.Save(room)
+	if err != nil {
+		log.Error("Room %v save snapshot failed: %v", room.Id, err)
+		return
+	}
+
+	snap := &RoomSnapshot{
+		Id:       room.Id,
+		Kind:     room.Kind,
+		Owner:    room.owner,
+		Reserved: room.reserved,
+		Seats:    make([]string, len(room.seats)),
+		Frame:    room.frame,
+		Seed:     room.seed,
+		Draws:    room.rngSource.draws,
+		Fair:     room.fair,
+		StartAt:  room.startAt.UnixNano() / int64(time.Millisecond),
+		Time:     room.now.UnixNano() / int64(time.Millisecond),
+		Tickets:  reservationMgr.RoomTickets(room.Id),
+		Logic:    string(data),
+	}
+	for i, seat := range room.seats {
+		if seat != nil {
+			snap.Seats[i] = seat.Name
+			if seat.bot != nil {
+				snap.Bots = append(snap.Bots, seat.Name)
+			}
+		}
+	}
+
+	if err = snapshotMgr.save(snap); err != nil {
+		log.Error("Room %v save snapshot failed: %v", room.Id, err)
+	}
+}
+
+func (room *Room) removeSnapshot() {
+	if _, ok := room.logic.(SnapshotLogic); ok && !room.replaying {
+		snapshotMgr.remove(room.Id)
+	}
+}
+
+// 从快照恢复游戏中的房间, 所有真人玩家视为掉线, 房间暂停直到全部重连或保留座位到期;
+// 本局已写入账本时不恢复, 避免重复结算
+func (mgr *RoomMgr) Restore(snap *RoomSnapshot) error {
+	if settlementMgr.Settled(settlementId(snap.Id, snap.StartAt, snap.Seed)) {
+		return ErrRoomSettled
+	}
+
+	logic, cfg, err := newGameLogic(snap.Kind)
+	if err != nil {
+		return err
+	}
+	sl, ok := logic.(SnapshotLogic)
+	if !ok {
+		return ErrKindNotSupported
+	}
+	if len(snap.Seats) == 0 {
+		return ErrInvalidRoom
+	}
+
+	room := makeRoom(snap.Id, snap.Kind, len(snap.Seats), snap.Reserved, logic, cfg)
+	room.state = proto.ROOM_STATE_PLAYING
+	room.owner = snap.Owner
+	room.frame = snap.Frame
+	room.seed = snap.Seed
+	room.fair = snap.Fair
+	room.startAt = time.Unix(0, snap.StartAt*int64(time.Millisecond))
+	room.rngSource = newCountingSource(snap.Seed)
+	room.rngSource.skip(snap.Draws)
+	room.rng = rand.New(room.rngSource)
+	room.paused = true
+	for i, name := range snap.Seats {
+		if name == "" {
+			continue
+		}
+		room.seats[i] = &Seat{Name: name, Ready: true}
+		if indexOf(snap.Bots, name) >= 0 && room.botCreator != nil {
+			room.seats[i].bot = room.botCreator()
+		}
+	}
+
+	mgr.Lock()
+	if _, exist := mgr.rooms[room.Id]; exist {
+		mgr.Unlock()
+		return ErrInvalidRoom
+	}
+	mgr.rooms[room.Id] = room
+	for _, seat := range room.seats {
+		if seat != nil && seat.bot == nil {
+			mgr.users[seat.Name] = room.Id
+		}
+	}
+	mgr.Unlock()
+
+	reservationMgr.Restore(snap.Tickets, roomMgr.reconnectHold)
+	room.updateSnapshot()
+
+	room.post(func() {
+		room.logic.OnCreate(room)
+		if err := sl.Load(room, []byte(snap.Logic)); err != nil {
+			log.Error("Room %v load snapshot failed: %v", room.Id, err)
+			room.close()
+			return
+		}
+		for _, seat := range room.seats {
+			if seat != nil && seat.bot == nil {
+				room.holdSeat(seat)
+			}
+		}
+		room.saveSnapshot()
+	})
+
+	util.Go(room.loop)
+
+	return nil
+}
@@ -4,17 +4,33 @@ import (
 	"github.com/nothollyhigh/kiss/log"
 	"github.com/nothollyhigh/kiss/net"
 	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"kisscluster/session"
 	"os"
-	// "kisscluster/proto"
 	"time"
 )
 
 var (
 	tcpServer = net.NewTcpServer("Plaza")
+	router    = session.NewRouter(tcpServer)
 )
 
 func startTcpServer() {
-	// tcpServer.Handle(cmd, hadnler)
+	if config.AuthKickThreshold > 0 {
+		router.KickThreshold = config.AuthKickThreshold
+	}
+	if err := router.HandleRealIp(config.TrustedGates); err != nil {
+		log.Panic("startTcpServer TrustedGates invalid: %v", err)
+	}
+
+	router.HandlePublic(proto.CMD_GAME_LOGIN_REQ, onGameLoginReq)
+	router.HandleAuth(proto.CMD_GAME_ROOM_LIST_REQ, onGameRoomListReq)
+	router.HandleAuth(proto.CMD_GAME_ROOM_CREATE_REQ, onGameRoomCreateReq)
+	router.HandleAuth(proto.CMD_GAME_ROOM_JOIN_REQ, onGameRoomJoinReq)
+	router.HandleAuth(proto.CMD_GAME_ROOM_LEAVE_REQ, onGameRoomLeaveReq)
+	router.HandleAuth(proto.CMD_GAME_ROOM_READY_REQ, onGameRoomReadyReq)
+	router.HandleAuth(proto.CMD_GAME_LOGIC_REQ, onGameLogicReq)
+	router.HandleAuth(proto.CMD_GAME_REPLAY_REQ, onGameReplayReq)
 
 	util.Go(func() {
 		tcpServer.Start(config.SvrAddr)
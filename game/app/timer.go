@@ -0,0 +1,80 @@
+package app
+
+const (
+	timerWheelSlots = 512
+)
+
+type wheelTimer struct {
+	id     int64
+	rounds int
+	f      func()
+}
+
+// 房间内的时间轮定时器, 每个房间 tick 前进一格, 只在房间 goroutine 中使用
+type TimerWheel struct {
+	slots  [][]*wheelTimer
+	pos    int
+	seq    int64
+	timers map[int64]*wheelTimer
+}
+
+func newTimerWheel() *TimerWheel {
+	return &TimerWheel{
+		slots:  make([][]*wheelTimer, timerWheelSlots),
+		timers: map[int64]*wheelTimer{},
+	}
+}
+
+// ticks 个 tick 后执行 f, 返回定时器 ID
+func (wheel *TimerWheel) After(ticks int, f func()) int64 {
+	if ticks < 1 {
+		ticks = 1
+	}
+
+	wheel.seq++
+	timer := &wheelTimer{
+		id:     wheel.seq,
+		rounds: (ticks - 1) / timerWheelSlots,
+		f:      f,
+	}
+	slot := (wheel.pos + ticks) % timerWheelSlots
+	wheel.slots[slot] = append(wheel.slots[slot], timer)
+	wheel.timers[timer.id] = timer
+
+	return timer.id
+}
+
+func (wheel *TimerWheel) Cancel(id int64) {
+	delete(wheel.timers, id)
+}
+
+// 前进一格并执行到期的定时器
+func (wheel *TimerWheel) Advance() {
+	wheel.pos = (wheel.pos + 1) % timerWheelSlots
+
+	var (
+		due     []*wheelTimer
+		pending = wheel.slots[wheel.pos][:0]
+	)
+	for _, timer := range wheel.slots[wheel.pos] {
+		if _, ok := wheel.timers[timer.id]; !ok {
+			continue
+		}
+		if timer.rounds > 0 {
+			timer.rounds--
+			pending = append(pending, timer)
+			continue
+		}
+		delete(wheel.timers, timer.id)
+		due = append(due, timer)
+	}
+	wheel.slots[wheel.pos] = pending
+
+	for _, timer := range due {
+		timer.f()
+	}
+}
+
+func (wheel *TimerWheel) Len() int {
+	return len(wheel.timers)
+}
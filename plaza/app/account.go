@@ -0,0 +1,346 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	bucketAccount = "account" // 用户名 -> 账号数据
+	bucketLogin   = "login"   // 登录账号 -> 用户名
+	bucketMeta    = "meta"
+	bucketDevice  = "device"  // 设备 ID -> 游客用户名
+	bucketExtAuth = "extauth" // 第三方平台:第三方用户 ID -> 用户名
+
+	guestPrefix = "guest_"
+
+	accountLenMin = 4
+	accountLenMax = 32
+	passwdLenMin  = 6
+	passwdLenMax  = 72 // bcrypt 只使用前 72 字节
+	deviceIdMax   = 128
+)
+
+var (
+	accountMgr = &AccountMgr{}
+
+	ErrAccountNotExist = errors.New("account not exist")
+	ErrInvalidAccount  = errors.New("invalid account")
+	ErrInvalidPasswd   = errors.New("invalid password")
+	ErrPasswdError     = errors.New("password error")
+	ErrInvalidDeviceId = errors.New("invalid device id")
+	ErrNotGuest        = errors.New("account already bound")
+	ErrAccountUsed     = errors.New("account already used")
+)
+
+// 账号数据, 以用户名 Name 为 key, 其他用户数据(好友等)也以 Name 为 key
+type Account struct {
+	Name      string `json:"name"`
+	Login     string `json:"login"`
+	Passwd    string `json:"passwd"`
+	Guest     bool   `json:"guest"`
+	DeviceId  string `json:"deviceId"`
+	External  string `json:"external"` // 第三方登录账号, 格式为 平台:第三方用户 ID
+	Vip       bool   `json:"vip"`
+	Created   int64  `json:"created"`
+	LastLogin int64  `json:"lastLogin"`
+	LastIp    string `json:"lastIp"`
+}
+
+// 密码为 bcrypt 哈希, 计算较慢, 不应在持有 AccountMgr 锁时调用
+func (acc *Account) checkPasswd(passwd string) bool {
+	if acc.Passwd == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(acc.Passwd), []byte(passwd)) == nil
+}
+
+func (acc *Account) setPasswd(passwd string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	acc.Passwd = string(hash)
+	return nil
+}
+
+func checkAccountFormat(login string, passwd string) error {
+	if n := utf8.RuneCountInString(login); n < accountLenMin || n > accountLenMax || strings.HasPrefix(login, guestPrefix) {
+		return ErrInvalidAccount
+	}
+	if len(passwd) < passwdLenMin || len(passwd) > passwdLenMax {
+		return ErrInvalidPasswd
+	}
+	return nil
+}
+
+type AccountMgr struct {
+	sync.Mutex
+}
+
+func (mgr *AccountMgr) Get(name string) (*Account, error) {
+	acc := &Account{}
+	ok, err := store.Get(bucketAccount, name, acc)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrAccountNotExist
+	}
+	return acc, nil
+}
+
+func (mgr *AccountMgr) Exist(name string) bool {
+	_, err := mgr.Get(name)
+	return err == nil
+}
+
+func (mgr *AccountMgr) Save(acc *Account) error {
+	return store.Put(bucketAccount, acc.Name, acc)
+}
+
+// 账号密码登录, 账号不存在时自动注册, ip 记录为最后登录 IP
+func (mgr *AccountMgr) Login(login string, passwd string, ip string) (*Account, error) {
+	if err := checkAccountFormat(login, passwd); err != nil {
+		return nil, err
+	}
+
+	var name string
+	ok, err := store.Get(bucketLogin, login, &name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return mgr.register(login, passwd, ip)
+	}
+
+	acc, err := mgr.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if !acc.checkPasswd(passwd) {
+		return nil, ErrPasswdError
+	}
+
+	// 校验密码时未加锁, 重新读取账号再更新登录信息, 期间密码被修改时登录失败
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	latest, err := mgr.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if latest.Passwd != acc.Passwd {
+		return nil, ErrPasswdError
+	}
+	latest.LastLogin = time.Now().Unix()
+	latest.LastIp = ip
+	return latest, mgr.Save(latest)
+}
+
+// 注册新账号, 登录账号和用户名都以原子创建占用, 多个大厅同时注册同一账号时只有一个成功
+func (mgr *AccountMgr) register(login string, passwd string, ip string) (*Account, error) {
+	if mgr.Exist(login) {
+		return nil, ErrInvalidAccount
+	}
+
+	now := time.Now().Unix()
+	acc := &Account{
+		Name:      login,
+		Login:     login,
+		Created:   now,
+		LastLogin: now,
+		LastIp:    ip,
+	}
+	if err := acc.setPasswd(passwd); err != nil {
+		return nil, err
+	}
+
+	ok, err := store.Create(bucketLogin, login, acc.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrAccountUsed
+	}
+	if ok, err = mgr.create(acc); err != nil || !ok {
+		store.Delete(bucketLogin, login)
+		if err == nil {
+			err = ErrAccountUsed
+		}
+		return nil, err
+	}
+
+	return acc, nil
+}
+
+// 游客登录, 设备已有未绑定的游客账号时返回该账号, 否则创建新游客账号并关联设备
+func (mgr *AccountMgr) GuestLogin(deviceId string, ip string) (*Account, error) {
+	if len(deviceId) > deviceIdMax {
+		return nil, ErrInvalidDeviceId
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if deviceId == "" {
+		return mgr.newGuest("", ip)
+	}
+
+	var name string
+	ok, err := store.Get(bucketDevice, deviceId, &name)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		acc, err := mgr.Get(name)
+		if err == nil && acc.Guest {
+			acc.LastLogin = time.Now().Unix()
+			acc.LastIp = ip
+			return acc, mgr.Save(acc)
+		}
+		if err != nil && err != ErrAccountNotExist {
+			return nil, err
+		}
+	}
+
+	acc, err := mgr.newGuest(deviceId, ip)
+	if err != nil {
+		return nil, err
+	}
+	return acc, store.Put(bucketDevice, deviceId, acc.Name)
+}
+
+// 新账号只在用户名未被占用时写入, 多个大厅共享存储时不会互相覆盖
+func (mgr *AccountMgr) create(acc *Account) (bool, error) {
+	return store.Create(bucketAccount, acc.Name, acc)
+}
+
+// 按持久化的序号生成用户名并创建账号, 序号只是起点, 多个大厅同时分配到同一序号时
+// 只有一个能占用该用户名, 其余的继续递增
+func (mgr *AccountMgr) createWithSeq(seqKey string, prefix string, acc *Account) error {
+	var seq int64
+	if _, err := store.Get(bucketMeta, seqKey, &seq); err != nil {
+		return err
+	}
+	for {
+		seq++
+		acc.Name = fmt.Sprintf("%v%v", prefix, seq)
+		ok, err := mgr.create(acc)
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+	}
+	return store.Put(bucketMeta, seqKey, seq)
+}
+
+// 创建游客账号, 游客序号持久化保证重启后不重复
+func (mgr *AccountMgr) newGuest(deviceId string, ip string) (*Account, error) {
+	now := time.Now().Unix()
+	acc := &Account{
+		Guest:     true,
+		DeviceId:  deviceId,
+		Created:   now,
+		LastLogin: now,
+		LastIp:    ip,
+	}
+
+	return acc, mgr.createWithSeq("guest_seq", guestPrefix, acc)
+}
+
+// 游客绑定账号密码, 用户名不变, 绑定后解除设备关联, 该设备再次游客登录时获得新的游客账号;
+// 登录账号以原子创建占用, 多个大厅同时绑定同一账号时只有一个成功, 保存账号失败时释放
+func (mgr *AccountMgr) Bind(name string, login string, passwd string) (*Account, error) {
+	if err := checkAccountFormat(login, passwd); err != nil {
+		return nil, err
+	}
+
+	// bcrypt 较慢, 在加锁前计算
+	hashed := &Account{}
+	if err := hashed.setPasswd(passwd); err != nil {
+		return nil, err
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	acc, err := mgr.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if !acc.Guest {
+		return nil, ErrNotGuest
+	}
+	if mgr.Exist(login) {
+		return nil, ErrAccountUsed
+	}
+
+	ok, err := store.Create(bucketLogin, login, acc.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrAccountUsed
+	}
+
+	deviceId := acc.DeviceId
+	acc.Login = login
+	acc.Guest = false
+	acc.DeviceId = ""
+	acc.Passwd = hashed.Passwd
+
+	if err = mgr.Save(acc); err != nil {
+		store.Delete(bucketLogin, login)
+		return nil, err
+	}
+	if deviceId != "" {
+		store.Delete(bucketDevice, deviceId)
+	}
+
+	return acc, nil
+}
+
+// 第三方登录, 首次登录时创建账号, 用户名为 平台_序号
+func (mgr *AccountMgr) ExternalLogin(provider string, externalId string, ip string) (*Account, error) {
+	external := provider + ":" + externalId
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	var name string
+	ok, err := store.Get(bucketExtAuth, external, &name)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		acc, err := mgr.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		acc.LastLogin = time.Now().Unix()
+		acc.LastIp = ip
+		return acc, mgr.Save(acc)
+	}
+
+	now := time.Now().Unix()
+	acc := &Account{
+		External:  external,
+		Created:   now,
+		LastLogin: now,
+		LastIp:    ip,
+	}
+	if err = mgr.createWithSeq("external_seq", provider+"_", acc); err != nil {
+		return nil, err
+	}
+
+	return acc, store.Put(bucketExtAuth, external, acc.Name)
+}
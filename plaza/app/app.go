@@ -31,6 +31,49 @@ type Config struct {
 
 	SvrAddr    string `json:"SvrAddr"`
 	StaticAddr string `json:"StaticAddr"`
+
+	StaticDir        string   `json:"StaticDir"`
+	ManifestRefresh  int      `json:"ManifestRefresh"`
+	MinClientVersion string   `json:"MinClientVersion"`
+	GateAddrs        []string `json:"GateAddrs"`
+	CdnBase          string   `json:"CdnBase"`
+
+	ClientVersions map[string]*ClientVersionConfig `json:"ClientVersions"`
+
+	AuthProviders map[string]*AuthProviderConfig `json:"AuthProviders"`
+
+	DataDir string `json:"DataDir"`
+
+	MaxOnline      int      `json:"MaxOnline"`
+	LoginQueueMax  int      `json:"LoginQueueMax"`
+	LoginWhitelist []string `json:"LoginWhitelist"`
+
+	Admins            []string `json:"Admins"`
+	AuthKickThreshold int      `json:"AuthKickThreshold"`
+
+	TrustedGates   []string `json:"TrustedGates"`
+	MaxOnlinePerIp int      `json:"MaxOnlinePerIp"`
+	LoginRatePerIp int      `json:"LoginRatePerIp"`
+	BannedIps      []string `json:"BannedIps"`
+
+	ChatMaxLen      int      `json:"ChatMaxLen"`
+	ChatHistory     int      `json:"ChatHistory"`
+	ChatRate        int      `json:"ChatRate"`
+	ChatRateWindow  int      `json:"ChatRateWindow"`
+	ChatBannedWords []string `json:"ChatBannedWords"`
+
+	FriendMax int `json:"FriendMax"`
+
+	NicknameLenMin     int     `json:"NicknameLenMin"`
+	NicknameLenMax     int     `json:"NicknameLenMax"`
+	AvatarMax          int     `json:"AvatarMax"`
+	ProfileSettingsMax int     `json:"ProfileSettingsMax"`
+	LevelExp           []int64 `json:"LevelExp"`
+
+	MailMax     int `json:"MailMax"`
+	MailRefresh int `json:"MailRefresh"`
+
+	Match map[string]*MatchConfig `json:"Match"`
 }
 
 func initConfig() {
@@ -81,15 +124,31 @@ func Run(version string) {
 
 	log.Info("app version: '%v'", version)
 
+	initStore()
+
+	banMgr.init()
+	initAuthProviders()
+
+	chatMgr.init()
+	friendMgr.init()
+	profileMgr.init()
+	mailMgr.init()
+	matchMgr.run()
+	loginQueue.run()
+	ipLimiter.init()
+
 	startCenterSession()
 
 	// startUpdateServerListTask()
 
 	startTcpServer()
+
+	staticServer.start()
 }
 
 func Stop() {
 	stopCenterSession()
 	stopTcpServer()
+	staticServer.stop()
 
 }
@@ -0,0 +1,227 @@
+package app
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/util"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	authProviders = map[string]AuthProvider{}
+
+	ErrAuthProviderNotExist = errors.New("auth provider not exist")
+	ErrAuthTokenInvalid     = errors.New("invalid token")
+	ErrAuthSignInvalid      = errors.New("invalid verify response sign")
+)
+
+// 第三方登录验证, Verify 校验 token 并返回第三方平台的用户 ID
+type AuthProvider interface {
+	Verify(token string) (externalId string, err error)
+}
+
+// 注册第三方登录验证, 应在 Run 之前调用, 与配置中同名的 HTTP 验证会被覆盖
+func RegisterAuthProvider(name string, provider AuthProvider) {
+	authProviders[name] = provider
+}
+
+func getAuthProvider(name string) (AuthProvider, error) {
+	if provider, ok := authProviders[name]; ok {
+		return provider, nil
+	}
+	return nil, ErrAuthProviderNotExist
+}
+
+// 按配置创建 HTTP 验证, 已通过 RegisterAuthProvider 注册的不覆盖
+func initAuthProviders() {
+	for name, cfg := range config.AuthProviders {
+		if _, ok := authProviders[name]; !ok {
+			authProviders[name] = NewHttpAuthProvider(name, cfg)
+		}
+	}
+}
+
+type AuthProviderConfig struct {
+	Url       string `json:"Url"`       // 验证地址
+	AppId     string `json:"AppId"`     // 在第三方平台的应用 ID
+	Secret    string `json:"Secret"`    // 签名密钥
+	Timeout   int    `json:"Timeout"`   // 验证请求超时, 单位秒
+	CacheTime int    `json:"CacheTime"` // 验证结果缓存时间, 单位秒
+	MaxSkew   int    `json:"MaxSkew"`   // 响应时间戳允许的误差, 单位秒
+}
+
+// HTTP 验证请求, Nonce 为每次请求随机生成, Sign = AuthSign(Secret, AppId, Token, Nonce, Timestamp)
+type AuthVerifyReq struct {
+	AppId     string `json:"appId"`
+	Token     string `json:"token"`
+	Nonce     string `json:"nonce"`
+	Timestamp int64  `json:"timestamp"`
+	Sign      string `json:"sign"`
+}
+
+// HTTP 验证响应, Code 为 0 时有效, Sign = AuthSign(Secret, Uid, 请求的 Token, 请求的 Nonce, Timestamp),
+// 签名包含请求的 token 和 nonce, 截获的响应不能用于其他请求
+type AuthVerifyRsp struct {
+	Code      int    `json:"code"`
+	Msg       string `json:"msg"`
+	Uid       string `json:"uid"`
+	Timestamp int64  `json:"timestamp"`
+	Sign      string `json:"sign"`
+}
+
+// 签名 hex(hmac_sha256(Secret, 各字段)), 每个字段写为 "长度:内容", 不同的字段值不会拼接出相同的内容
+func AuthSign(secret string, fields ...interface{}) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	for _, v := range fields {
+		s := fmt.Sprint(v)
+		fmt.Fprintf(mac, "%d:%s", len(s), s)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type authCacheItem struct {
+	uid    string
+	expire time.Time
+}
+
+// 调用第三方验证地址校验 token, 验证结果按 token 缓存
+type HttpAuthProvider struct {
+	sync.Mutex
+
+	name   string
+	cfg    *AuthProviderConfig
+	client *http.Client
+	cache  map[string]*authCacheItem
+}
+
+func NewHttpAuthProvider(name string, cfg *AuthProviderConfig) *HttpAuthProvider {
+	timeout := time.Second * time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = time.Second * 5
+	}
+
+	provider := &HttpAuthProvider{
+		name:   name,
+		cfg:    cfg,
+		client: &http.Client{Timeout: timeout},
+		cache:  map[string]*authCacheItem{},
+	}
+
+	util.Go(func() {
+		for {
+			time.Sleep(time.Minute)
+			provider.clearExpired()
+		}
+	})
+
+	return provider
+}
+
+func (provider *HttpAuthProvider) cacheTime() time.Duration {
+	if provider.cfg.CacheTime > 0 {
+		return time.Second * time.Duration(provider.cfg.CacheTime)
+	}
+	return time.Minute * 5
+}
+
+func (provider *HttpAuthProvider) maxSkew() int64 {
+	if provider.cfg.MaxSkew > 0 {
+		return int64(provider.cfg.MaxSkew)
+	}
+	return 300
+}
+
+func (provider *HttpAuthProvider) clearExpired() {
+	provider.Lock()
+	defer provider.Unlock()
+
+	now := time.Now()
+	for token, item := range provider.cache {
+		if now.After(item.expire) {
+			delete(provider.cache, token)
+		}
+	}
+}
+
+func (provider *HttpAuthProvider) Verify(token string) (string, error) {
+	if token == "" {
+		return "", ErrAuthTokenInvalid
+	}
+
+	provider.Lock()
+	item, ok := provider.cache[token]
+	provider.Unlock()
+	if ok && time.Now().Before(item.expire) {
+		return item.uid, nil
+	}
+
+	uid, err := provider.verify(token)
+	if err != nil {
+		return "", err
+	}
+
+	provider.Lock()
+	provider.cache[token] = &authCacheItem{uid: uid, expire: time.Now().Add(provider.cacheTime())}
+	provider.Unlock()
+
+	return uid, nil
+}
+
+func (provider *HttpAuthProvider) verify(token string) (string, error) {
+	cfg := provider.cfg
+	req := &AuthVerifyReq{
+		AppId:     cfg.AppId,
+		Token:     token,
+		Nonce:     randomId(16),
+		Timestamp: time.Now().Unix(),
+	}
+	req.Sign = AuthSign(cfg.Secret, req.AppId, req.Token, req.Nonce, req.Timestamp)
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	httpRsp, err := provider.client.Post(cfg.Url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Error("HttpAuthProvider(%v) verify failed: %v", provider.name, err)
+		return "", err
+	}
+	defer httpRsp.Body.Close()
+
+	body, err := ioutil.ReadAll(httpRsp.Body)
+	if err != nil {
+		return "", err
+	}
+	if httpRsp.StatusCode != http.StatusOK {
+		log.Error("HttpAuthProvider(%v) verify failed: status %v", provider.name, httpRsp.StatusCode)
+		return "", fmt.Errorf("verify failed: status %v", httpRsp.StatusCode)
+	}
+
+	rsp := &AuthVerifyRsp{}
+	if err = json.Unmarshal(body, rsp); err != nil {
+		return "", err
+	}
+	if rsp.Code != 0 || rsp.Uid == "" {
+		return "", ErrAuthTokenInvalid
+	}
+
+	skew := time.Now().Unix() - rsp.Timestamp
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > provider.maxSkew() || !hmac.Equal([]byte(rsp.Sign), []byte(AuthSign(cfg.Secret, rsp.Uid, req.Token, req.Nonce, rsp.Timestamp))) {
+		log.Error("HttpAuthProvider(%v) verify failed: invalid sign", provider.name)
+		return "", ErrAuthSignInvalid
+	}
+
+	return rsp.Uid, nil
+}
@@ -0,0 +1,301 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"kisscluster/session"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	bucketBan = "ban"
+)
+
+var (
+	banMgr = &BanMgr{
+		bans:   map[string]*proto.BanInfo{},
+		nets:   map[string]*net.IPNet{},
+		lifted: map[string]int64{},
+	}
+
+	ErrBanInvalid  = errors.New("invalid ban")
+	ErrBanNotExist = errors.New("ban not exist")
+)
+
+func randomId(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func banExpired(ban *proto.BanInfo, now int64) bool {
+	return ban.Expire > 0 && ban.Expire <= now
+}
+
+// 账号和 IP 封禁, 持久化到存储并经中心服务器同步到其他大厅
+type BanMgr struct {
+	sync.RWMutex
+	bans   map[string]*proto.BanInfo
+	nets   map[string]*net.IPNet // IP 封禁的解析结果
+	lifted map[string]int64      // 本次运行中解除的封禁 -> 解除时间, 重连中心服务器时上报, 保留 BAN_LIFTED_KEEP 秒
+}
+
+func (mgr *BanMgr) init() {
+	keys, err := store.Keys(bucketBan)
+	if err != nil {
+		log.Panic("BanMgr init failed: %v", err)
+	}
+
+	now := time.Now().Unix()
+	for _, key := range keys {
+		ban := &proto.BanInfo{}
+		if ok, err := store.Get(bucketBan, key, ban); err != nil || !ok {
+			log.Error("BanMgr init load %v failed: %v", key, err)
+			continue
+		}
+		if banExpired(ban, now) {
+			store.Delete(bucketBan, key)
+			continue
+		}
+		if err = mgr.set(ban); err != nil {
+			log.Error("BanMgr init %v failed: %v", key, err)
+		}
+	}
+
+	log.Info("BanMgr init, %v bans", len(mgr.bans))
+
+	util.Go(func() {
+		for {
+			time.Sleep(time.Minute)
+			mgr.clearExpired()
+		}
+	})
+}
+
+func (mgr *BanMgr) set(ban *proto.BanInfo) error {
+	var ipnet *net.IPNet
+
+	switch ban.Type {
+	case proto.BAN_TYPE_ACCOUNT:
+	case proto.BAN_TYPE_IP:
+		nets, err := session.ParseNets([]string{ban.Target})
+		if err != nil || len(nets) != 1 {
+			return ErrBanInvalid
+		}
+		ipnet = nets[0]
+	default:
+		return ErrBanInvalid
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	mgr.bans[ban.Id] = ban
+	if ipnet != nil {
+		mgr.nets[ban.Id] = ipnet
+	}
+
+	return nil
+}
+
+func (mgr *BanMgr) unset(id string) (*proto.BanInfo, bool) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	ban, ok := mgr.bans[id]
+	delete(mgr.bans, id)
+	delete(mgr.nets, id)
+	now := time.Now().Unix()
+	mgr.lifted[id] = now
+	for liftedId, at := range mgr.lifted {
+		if now-at > proto.BAN_LIFTED_KEEP {
+			delete(mgr.lifted, liftedId)
+		}
+	}
+
+	return ban, ok
+}
+
+// 添加封禁, 立即踢掉被封禁的在线用户并同步到其他大厅
+func (mgr *BanMgr) Add(ban *proto.BanInfo) error {
+	if ban.Target == "" {
+		return ErrBanInvalid
+	}
+
+	ban.Id = randomId(8)
+	ban.Created = time.Now().Unix()
+
+	if err := mgr.set(ban); err != nil {
+		return err
+	}
+	if err := store.Put(bucketBan, ban.Id, ban); err != nil {
+		mgr.unset(ban.Id)
+		return err
+	}
+
+	mgr.enforce(ban)
+	syncBan(ban, false)
+
+	log.Info("BanMgr Add: %+v", *ban)
+
+	return nil
+}
+
+func (mgr *BanMgr) Lift(id string) error {
+	ban, ok := mgr.unset(id)
+	if !ok {
+		return ErrBanNotExist
+	}
+	if err := store.Delete(bucketBan, id); err != nil {
+		return err
+	}
+
+	syncBan(ban, true)
+
+	log.Info("BanMgr Lift: %+v", *ban)
+
+	return nil
+}
+
+// 处理其他大厅同步过来的封禁变化
+func (mgr *BanMgr) OnSync(ban *proto.BanInfo, lift bool) {
+	if lift {
+		mgr.unset(ban.Id)
+		store.Delete(bucketBan, ban.Id)
+		return
+	}
+
+	if err := mgr.set(ban); err != nil {
+		log.Error("BanMgr OnSync %v failed: %v", ban.Id, err)
+		return
+	}
+	store.Put(bucketBan, ban.Id, ban)
+	mgr.enforce(ban)
+}
+
+func (mgr *BanMgr) Lifted() []string {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	now := time.Now().Unix()
+	lifted := make([]string, 0, len(mgr.lifted))
+	for id, at := range mgr.lifted {
+		if now-at <= proto.BAN_LIFTED_KEEP {
+			lifted = append(lifted, id)
+		}
+	}
+	return lifted
+}
+
+// 合并中心服务器返回的全部封禁, 补齐断线期间其他大厅的变化
+func (mgr *BanMgr) Merge(bans []*proto.BanInfo, lifted []string) {
+	for _, id := range lifted {
+		mgr.RLock()
+		_, ok := mgr.bans[id]
+		mgr.RUnlock()
+		if ok {
+			mgr.OnSync(&proto.BanInfo{Id: id}, true)
+		}
+	}
+	for _, ban := range bans {
+		mgr.RLock()
+		_, ok := mgr.bans[ban.Id]
+		mgr.RUnlock()
+		if !ok {
+			mgr.OnSync(ban, false)
+		}
+	}
+}
+
+func (mgr *BanMgr) List() []*proto.BanInfo {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	now := time.Now().Unix()
+	bans := make([]*proto.BanInfo, 0, len(mgr.bans))
+	for _, ban := range mgr.bans {
+		if !banExpired(ban, now) {
+			bans = append(bans, ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].Created < bans[j].Created
+	})
+
+	return bans
+}
+
+// 检查 IP 是否被封禁
+func (mgr *BanMgr) CheckIp(ip string) (*proto.BanInfo, bool) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, false
+	}
+
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	now := time.Now().Unix()
+	for id, ipnet := range mgr.nets {
+		if ban := mgr.bans[id]; !banExpired(ban, now) && ipnet.Contains(addr) {
+			return ban, true
+		}
+	}
+	return nil, false
+}
+
+// 检查用户名是否被封禁
+func (mgr *BanMgr) CheckAccount(name string) (*proto.BanInfo, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	now := time.Now().Unix()
+	for _, ban := range mgr.bans {
+		if ban.Type == proto.BAN_TYPE_ACCOUNT && ban.Target == name && !banExpired(ban, now) {
+			return ban, true
+		}
+	}
+	return nil, false
+}
+
+// 踢掉被封禁的在线用户
+func (mgr *BanMgr) enforce(ban *proto.BanInfo) {
+	notify := &proto.PlazaKickNotify{
+		Code: proto.CODE_BANNED,
+		Msg:  ban.Reason,
+		Ban:  ban,
+	}
+
+	switch ban.Type {
+	case proto.BAN_TYPE_ACCOUNT:
+		userMgr.Kick(ban.Target, notify)
+	case proto.BAN_TYPE_IP:
+		nets, _ := session.ParseNets([]string{ban.Target})
+		for name, client := range userMgr.Clients() {
+			if session.ContainsIp(nets, router.Session(client).Ip()) {
+				userMgr.Kick(name, notify)
+			}
+		}
+	}
+}
+
+func (mgr *BanMgr) clearExpired() {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	now := time.Now().Unix()
+	for id, ban := range mgr.bans {
+		if banExpired(ban, now) {
+			delete(mgr.bans, id)
+			delete(mgr.nets, id)
+			store.Delete(bucketBan, id)
+		}
+	}
+}
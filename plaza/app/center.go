@@ -1,19 +1,35 @@
 package app
 
 import (
+	"fmt"
 	"github.com/nothollyhigh/kiss/log"
 	"github.com/nothollyhigh/kiss/net"
 	"github.com/nothollyhigh/kiss/util"
 	"kisscluster/proto"
+	"sync"
 	"time"
 )
 
 var (
 	centerSession *net.RpcClient
 
-	gameList = map[string]*proto.ServerInfo{}
+	gameList    = map[string]*proto.ServerInfo{}
+	gameListMtx sync.RWMutex
 )
 
+// 游戏服务器列表整体替换, 不修改已有的列表, 读取方拿到后可以不加锁使用
+func getGameList() map[string]*proto.ServerInfo {
+	gameListMtx.RLock()
+	defer gameListMtx.RUnlock()
+	return gameList
+}
+
+func setGameList(list map[string]*proto.ServerInfo) {
+	gameListMtx.Lock()
+	defer gameListMtx.Unlock()
+	gameList = list
+}
+
 func updatePlazaInfo() {
 	var (
 		req = &proto.CenterUpdateServerInfoReq{
@@ -41,6 +57,157 @@ func updatePlazaInfo() {
 func onConnectedCenter(client *net.RpcClient) {
 	centerSession = client
 	updatePlazaInfo()
+	syncUsers()
+	util.Go(syncBans)
+}
+
+// 上报本地封禁并拉取全部封禁, 断线期间的封禁变化在重连后生效
+func syncBans() {
+	var (
+		req = &proto.CenterBanListReq{
+			Plaza:  config.SvrID,
+			Bans:   banMgr.List(),
+			Lifted: banMgr.Lifted(),
+		}
+		rsp = &proto.CenterBanListRsp{}
+	)
+
+	err := centerSession.Call(proto.RPC_METHOD_BAN_LIST, req, rsp, time.Second*3)
+	if err != nil {
+		log.Error("syncBans failed: %v", err)
+		return
+	}
+	if rsp.Code != 0 {
+		log.Error("syncBans failed, code: %v, msg: %v", rsp.Code, rsp.Msg)
+		return
+	}
+
+	banMgr.Merge(rsp.Bans, rsp.Lifted)
+
+	log.Info("syncBans success, bans: %v, lifted: %v", len(rsp.Bans), len(rsp.Lifted))
+}
+
+// 同步本大厅全部在线用户到中心服务器的用户目录
+func syncUsers() {
+	var (
+		req = &proto.CenterUserSyncReq{
+			Plaza: config.SvrID,
+			Names: userMgr.Names(),
+		}
+		rsp = &proto.CenterUserSyncRsp{}
+	)
+
+	err := centerSession.Call(proto.RPC_METHOD_USER_SYNC, req, rsp, time.Second*3)
+	if err != nil {
+		log.Error("syncUsers failed: %v", err)
+		return
+	}
+	if rsp.Code != 0 {
+		log.Error("syncUsers failed, code: %v, msg: %v", rsp.Code, rsp.Msg)
+	}
+}
+
+func registerUser(name string) {
+	util.Go(func() {
+		var (
+			req = &proto.CenterUserOnlineReq{
+				Plaza: config.SvrID,
+				Name:  name,
+			}
+			rsp = &proto.CenterUserOnlineRsp{}
+		)
+
+		err := centerSession.Call(proto.RPC_METHOD_USER_ONLINE, req, rsp, time.Second*3)
+		if err != nil {
+			log.Error("registerUser %v failed: %v", name, err)
+			return
+		}
+		if rsp.Code != 0 {
+			log.Error("registerUser %v failed, code: %v, msg: %v", name, rsp.Code, rsp.Msg)
+		}
+	})
+}
+
+func unregisterUser(name string) {
+	util.Go(func() {
+		var (
+			req = &proto.CenterUserOfflineReq{
+				Plaza: config.SvrID,
+				Name:  name,
+			}
+			rsp = &proto.CenterUserOfflineRsp{}
+		)
+
+		err := centerSession.Call(proto.RPC_METHOD_USER_OFFLINE, req, rsp, time.Second*3)
+		if err != nil {
+			log.Error("unregisterUser %v failed: %v", name, err)
+			return
+		}
+		if rsp.Code != 0 {
+			log.Error("unregisterUser %v failed, code: %v, msg: %v", name, rsp.Code, rsp.Msg)
+		}
+	})
+}
+
+// 查询用户在集群中的位置, 结果中不存在的用户为离线
+func lookupUsers(names []string) (map[string]*proto.UserLocation, error) {
+	var (
+		req = &proto.CenterUserLookupReq{
+			Names: names,
+		}
+		rsp = &proto.CenterUserLookupRsp{}
+	)
+
+	err := centerSession.Call(proto.RPC_METHOD_USER_LOOKUP, req, rsp, time.Second*3)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.Code != 0 {
+		return nil, fmt.Errorf("code: %v, msg: %v", rsp.Code, rsp.Msg)
+	}
+
+	return rsp.Users, nil
+}
+
+// 投递消息给集群中的在线用户, 优先本大厅, 否则经中心服务器路由到用户所在大厅
+func deliverToUser(name string, cmd uint32, v interface{}) int {
+	msg := proto.NewMessage(cmd, v)
+	if userMgr.SendTo(name, msg) {
+		return proto.CODE_OK
+	}
+
+	var (
+		req = &proto.CenterUserDeliverReq{
+			To:   name,
+			Cmd:  cmd,
+			Body: msg.Body(),
+		}
+		rsp = &proto.CenterUserDeliverRsp{}
+	)
+
+	err := centerSession.Call(proto.RPC_METHOD_USER_DELIVER, req, rsp, time.Second*3)
+	if err != nil {
+		log.Error("deliverToUser %v failed: %v", name, err)
+		return proto.CODE_ERROR
+	}
+
+	return rsp.Code
+}
+
+func onUserDeliverNotify(client *net.TcpClient, msg net.IMessage) {
+	var (
+		notify = &proto.CenterUserDeliverNotify{}
+	)
+
+	err := proto.Unmarshal(msg.Body(), notify)
+	if err != nil {
+		log.Error("onUserDeliverNotify bind failed: %v", err)
+		return
+	}
+
+	if !userMgr.SendTo(notify.To, net.NewMessage(notify.Cmd, notify.Body)) {
+		log.Debug("onUserDeliverNotify %v offline, cmd: %v", notify.To, notify.Cmd)
+	}
 }
 
 func onUpdateGameListNotify(client *net.TcpClient, msg net.IMessage) {
@@ -53,17 +220,147 @@ func onUpdateGameListNotify(client *net.TcpClient, msg net.IMessage) {
 		log.Error("onUpdateGameListNotify bind failed: %v", err)
 	} else {
 		log.Info("onUpdateGameListNotify success: %v", string(msg.Body()))
-		gameList = serverList
+		setGameList(serverList)
 		userMgr.BroadcastGameList()
 	}
 }
 
+func onChatNotify(client *net.TcpClient, msg net.IMessage) {
+	var (
+		chat = &proto.ChatMsg{}
+	)
+
+	err := proto.Unmarshal(msg.Body(), chat)
+	if err != nil {
+		log.Error("onChatNotify bind failed: %v", err)
+		return
+	}
+
+	chatMgr.Dispatch(chat)
+}
+
+func onUserStatusNotify(client *net.TcpClient, msg net.IMessage) {
+	var (
+		loc = &proto.UserLocation{}
+	)
+
+	err := proto.Unmarshal(msg.Body(), loc)
+	if err != nil {
+		log.Error("onUserStatusNotify bind failed: %v", err)
+		return
+	}
+
+	util.Go(func() {
+		friendMgr.NotifyStatus(loc.Name, loc)
+	})
+}
+
+func onBanNotify(client *net.TcpClient, msg net.IMessage) {
+	var (
+		req = &proto.CenterBanSyncReq{}
+	)
+
+	err := proto.Unmarshal(msg.Body(), req)
+	if err != nil || req.Ban == nil {
+		log.Error("onBanNotify bind failed: %v", err)
+		return
+	}
+
+	banMgr.OnSync(req.Ban, req.Lift)
+
+	log.Info("onBanNotify from %v: %v", req.Plaza, string(msg.Body()))
+}
+
+// 同步封禁变化到其他大厅
+func syncBan(ban *proto.BanInfo, lift bool) {
+	util.Go(func() {
+		var (
+			req = &proto.CenterBanSyncReq{
+				Plaza: config.SvrID,
+				Ban:   ban,
+				Lift:  lift,
+			}
+			rsp = &proto.CenterBanSyncRsp{}
+		)
+
+		err := centerSession.Call(proto.RPC_METHOD_BAN_SYNC, req, rsp, time.Second*3)
+		if err != nil {
+			log.Error("syncBan %v failed: %v", ban.Id, err)
+			return
+		}
+		if rsp.Code != 0 {
+			log.Error("syncBan %v failed, code: %v, msg: %v", ban.Id, rsp.Code, rsp.Msg)
+		}
+	})
+}
+
+func onMaintenanceNotify(client *net.TcpClient, msg net.IMessage) {
+	var (
+		info = proto.MaintenanceInfo{}
+	)
+
+	err := proto.Unmarshal(msg.Body(), &info)
+	if err != nil {
+		log.Error("onMaintenanceNotify bind failed: %v", err)
+		return
+	}
+
+	maintenance.Update(info)
+}
+
+// 设置集群停服维护状态, 由中心服务器同步到所有大厅
+func setMaintenance(info proto.MaintenanceInfo) error {
+	var (
+		req = &proto.CenterSetMaintenanceReq{
+			MaintenanceInfo: info,
+		}
+		rsp = &proto.CenterSetMaintenanceRsp{}
+	)
+
+	err := centerSession.Call(proto.RPC_METHOD_SET_MAINTENANCE, req, rsp, time.Second*3)
+	if err != nil {
+		return err
+	}
+	if rsp.Code != 0 {
+		return fmt.Errorf("code: %v, msg: %v", rsp.Code, rsp.Msg)
+	}
+	return nil
+}
+
+// 转发频道聊天消息到其他大厅
+func relayChat(chat *proto.ChatMsg) {
+	util.Go(func() {
+		var (
+			req = &proto.CenterChatRelayReq{
+				Plaza: config.SvrID,
+				Chat:  chat,
+			}
+			rsp = &proto.CenterChatRelayRsp{}
+		)
+
+		err := centerSession.Call(proto.RPC_METHOD_CHAT_RELAY, req, rsp, time.Second*3)
+		if err != nil {
+			log.Error("relayChat failed: %v", err)
+			return
+		}
+		if rsp.Code != 0 {
+			log.Error("relayChat failed, code: %v, msg: %v", rsp.Code, rsp.Msg)
+		}
+	})
+}
+
 func startCenterSession() {
 	var (
 		err       error
 		netengine = net.NewTcpEngine()
 	)
 	netengine.Handle(proto.CMD_CENTER_UPDATE_GAME_LIST_NOTIFY, onUpdateGameListNotify)
+	netengine.Handle(proto.CMD_CENTER_CHAT_NOTIFY, onChatNotify)
+	netengine.Handle(proto.CMD_CENTER_USER_DELIVER_NOTIFY, onUserDeliverNotify)
+	netengine.Handle(proto.CMD_CENTER_USER_STATUS_NOTIFY, onUserStatusNotify)
+	netengine.Handle(proto.CMD_CENTER_BAN_NOTIFY, onBanNotify)
+	netengine.Handle(proto.CMD_CENTER_MAINTENANCE_NOTIFY, onMaintenanceNotify)
+	netengine.Handle(proto.CMD_CENTER_SETTLE_NOTIFY, onSettleNotify)
 
 	centerSession, err = net.NewRpcClient(config.CenterAddr, netengine, nil, onConnectedCenter)
 	if err != nil {
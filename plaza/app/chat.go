@@ -0,0 +1,277 @@
+package app
+
+import (
+	"errors"
+	"github.com/nothollyhigh/kiss/log"
+	"kisscluster/proto"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	chatChannelNameMax = 32
+)
+
+var (
+	chatMgr = &ChatMgr{
+		world:    &ChatChannel{Name: proto.CHAT_CHANNEL_WORLD},
+		channels: map[string]*ChatChannel{},
+		limiters: map[string][]time.Time{},
+	}
+
+	chatFilter ChatFilter = defaultChatFilter
+
+	ErrChatNotInChannel = errors.New("not in channel")
+)
+
+// 聊天内容过滤钩子, 返回过滤后的内容, ok 为 false 时拒绝发送
+type ChatFilter func(from string, content string) (filtered string, ok bool)
+
+// 设置聊天内容过滤钩子, 应在 Run 之前调用
+func SetChatFilter(filter ChatFilter) {
+	chatFilter = filter
+}
+
+// 默认过滤: 将配置的屏蔽词替换为 *
+func defaultChatFilter(from string, content string) (string, bool) {
+	for _, word := range config.ChatBannedWords {
+		if word != "" {
+			content = strings.Replace(content, word, strings.Repeat("*", utf8.RuneCountInString(word)), -1)
+		}
+	}
+	return content, true
+}
+
+type ChatChannel struct {
+	Name    string
+	members map[string]struct{}
+	history []*proto.ChatMsg
+}
+
+func (channel *ChatChannel) record(msg *proto.ChatMsg, max int) {
+	channel.history = append(channel.history, msg)
+	if len(channel.history) > max {
+		channel.history = channel.history[len(channel.history)-max:]
+	}
+}
+
+func (channel *ChatChannel) History() []*proto.ChatMsg {
+	return append([]*proto.ChatMsg{}, channel.history...)
+}
+
+type ChatMgr struct {
+	sync.RWMutex
+
+	maxLen     int
+	maxHistory int
+	rate       int
+	rateWindow time.Duration
+
+	world    *ChatChannel
+	channels map[string]*ChatChannel
+	limiters map[string][]time.Time
+}
+
+func (mgr *ChatMgr) init() {
+	mgr.maxLen = config.ChatMaxLen
+	if mgr.maxLen <= 0 {
+		mgr.maxLen = 200
+	}
+	mgr.maxHistory = config.ChatHistory
+	if mgr.maxHistory <= 0 {
+		mgr.maxHistory = 50
+	}
+	mgr.rate = config.ChatRate
+	mgr.rateWindow = time.Second * time.Duration(config.ChatRateWindow)
+	if mgr.rateWindow <= 0 {
+		mgr.rateWindow = time.Second * 10
+	}
+}
+
+// 加入频道, 返回频道历史消息
+func (mgr *ChatMgr) Join(name string, channelName string) ([]*proto.ChatMsg, error) {
+	if channelName == "" || utf8.RuneCountInString(channelName) > chatChannelNameMax {
+		return nil, errors.New("invalid channel")
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if channelName == proto.CHAT_CHANNEL_WORLD {
+		return mgr.world.History(), nil
+	}
+
+	channel, ok := mgr.channels[channelName]
+	if !ok {
+		channel = &ChatChannel{
+			Name:    channelName,
+			members: map[string]struct{}{},
+		}
+		mgr.channels[channelName] = channel
+	}
+	channel.members[name] = struct{}{}
+
+	return channel.History(), nil
+}
+
+func (mgr *ChatMgr) Leave(name string, channelName string) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	channel, ok := mgr.channels[channelName]
+	if !ok {
+		return ErrChatNotInChannel
+	}
+	if _, ok = channel.members[name]; !ok {
+		return ErrChatNotInChannel
+	}
+
+	mgr.leave(name, channel)
+
+	return nil
+}
+
+func (mgr *ChatMgr) leave(name string, channel *ChatChannel) {
+	delete(channel.members, name)
+	if len(channel.members) == 0 {
+		delete(mgr.channels, channel.Name)
+	}
+}
+
+// 用户下线, 离开所有频道
+func (mgr *ChatMgr) RemoveUser(name string) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	for _, channel := range mgr.channels {
+		if _, ok := channel.members[name]; ok {
+			mgr.leave(name, channel)
+		}
+	}
+	delete(mgr.limiters, name)
+}
+
+// 频率限制: rateWindow 时间内最多发送 rate 条
+func (mgr *ChatMgr) allow(name string, now time.Time) bool {
+	if mgr.rate <= 0 {
+		return true
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	times := mgr.limiters[name]
+	for len(times) > 0 && now.Sub(times[0]) >= mgr.rateWindow {
+		times = times[1:]
+	}
+	if len(times) >= mgr.rate {
+		mgr.limiters[name] = times
+		return false
+	}
+	mgr.limiters[name] = append(times, now)
+
+	return true
+}
+
+func (mgr *ChatMgr) Send(from string, req *proto.PlazaChatSendReq) (code int, err error) {
+	var (
+		ok      bool
+		now     = time.Now()
+		content = req.Content
+	)
+
+	if content == "" {
+		return -1, errors.New("empty content")
+	}
+	if utf8.RuneCountInString(content) > mgr.maxLen {
+		return -1, errors.New("content too long")
+	}
+	if req.Channel == "" && req.To == "" {
+		return -1, errors.New("invalid target")
+	}
+	if !mgr.allow(from, now) {
+		return -1, errors.New("send too fast")
+	}
+	if content, ok = chatFilter(from, content); !ok {
+		return -1, errors.New("content rejected")
+	}
+
+	msg := &proto.ChatMsg{
+		Channel: req.Channel,
+		From:    from,
+		Content: content,
+		Time:    now.Unix(),
+	}
+
+	if msg.Channel == "" {
+		msg.To = req.To
+		switch code = deliverToUser(msg.To, proto.CMD_PLAZA_CHAT_MSG_NOTIFY, msg); code {
+		case proto.CODE_OK:
+		case proto.CODE_USER_OFFLINE:
+			return code, errors.New("user offline")
+		default:
+			return code, errors.New("deliver failed")
+		}
+		if msg.To != from {
+			userMgr.SendTo(from, proto.NewMessage(proto.CMD_PLAZA_CHAT_MSG_NOTIFY, msg))
+		}
+		return 0, nil
+	}
+
+	if msg.Channel != proto.CHAT_CHANNEL_WORLD && !mgr.isMember(from, msg.Channel) {
+		return -1, ErrChatNotInChannel
+	}
+
+	mgr.Dispatch(msg)
+	relayChat(msg)
+
+	return 0, nil
+}
+
+func (mgr *ChatMgr) isMember(name string, channelName string) bool {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	if channel, ok := mgr.channels[channelName]; ok {
+		_, ok = channel.members[name]
+		return ok
+	}
+	return false
+}
+
+// 投递频道消息给本大厅的频道成员, 本大厅没有该频道时返回 false
+func (mgr *ChatMgr) Dispatch(msg *proto.ChatMsg) bool {
+	notify := proto.NewMessage(proto.CMD_PLAZA_CHAT_MSG_NOTIFY, msg)
+
+	if msg.Channel == proto.CHAT_CHANNEL_WORLD {
+		mgr.Lock()
+		mgr.world.record(msg, mgr.maxHistory)
+		mgr.Unlock()
+
+		userMgr.Broadcast(notify)
+		return true
+	}
+
+	mgr.Lock()
+	channel, ok := mgr.channels[msg.Channel]
+	if !ok {
+		mgr.Unlock()
+		return false
+	}
+	channel.record(msg, mgr.maxHistory)
+	members := make([]string, 0, len(channel.members))
+	for name := range channel.members {
+		members = append(members, name)
+	}
+	mgr.Unlock()
+
+	for _, name := range members {
+		userMgr.SendTo(name, notify)
+	}
+
+	log.Debug("ChatMgr Dispatch to %v members of '%v'", len(members), msg.Channel)
+
+	return true
+}
@@ -0,0 +1,262 @@
+package app
+
+import (
+	"errors"
+	"github.com/nothollyhigh/kiss/log"
+	"kisscluster/proto"
+	"sync"
+)
+
+const (
+	bucketFriend = "friend"
+)
+
+var (
+	friendMgr = &FriendMgr{}
+
+	ErrFriendSelf      = errors.New("can not add yourself")
+	ErrFriendExist     = errors.New("already friends")
+	ErrFriendNotExist  = errors.New("not friends")
+	ErrFriendRequested = errors.New("already requested")
+	ErrFriendNoRequest = errors.New("no such request")
+	ErrFriendFull      = errors.New("friend list full")
+)
+
+// 好友关系数据, 以用户名为 key 持久化
+type FriendData struct {
+	Friends  []string `json:"friends"`
+	Requests []string `json:"requests"` // 收到的好友申请
+}
+
+func indexOf(list []string, name string) int {
+	for i, v := range list {
+		if v == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func removeString(list []string, name string) []string {
+	if i := indexOf(list, name); i >= 0 {
+		return append(list[:i], list[i+1:]...)
+	}
+	return list
+}
+
+type FriendMgr struct {
+	sync.Mutex
+	max int
+}
+
+func (mgr *FriendMgr) init() {
+	mgr.max = config.FriendMax
+	if mgr.max <= 0 {
+		mgr.max = 100
+	}
+}
+
+func (mgr *FriendMgr) load(name string) (*FriendData, error) {
+	data := &FriendData{}
+	if _, err := store.Get(bucketFriend, name, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (mgr *FriendMgr) save(name string, data *FriendData) error {
+	return store.Put(bucketFriend, name, data)
+}
+
+func (mgr *FriendMgr) Get(name string) (*FriendData, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	return mgr.load(name)
+}
+
+// friend 是否在 name 的好友列表中
+func (mgr *FriendMgr) IsFriend(name string, friend string) (bool, error) {
+	data, err := mgr.Get(name)
+	if err != nil {
+		return false, err
+	}
+	return indexOf(data.Friends, friend) >= 0, nil
+}
+
+// 发送好友申请, 记录到对方的申请列表
+func (mgr *FriendMgr) Request(from string, to string) error {
+	if from == to {
+		return ErrFriendSelf
+	}
+	if !accountMgr.Exist(to) {
+		return ErrAccountNotExist
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	data, err := mgr.load(to)
+	if err != nil {
+		return err
+	}
+	if indexOf(data.Friends, from) >= 0 {
+		return ErrFriendExist
+	}
+	if indexOf(data.Requests, from) >= 0 {
+		return ErrFriendRequested
+	}
+
+	data.Requests = append(data.Requests, from)
+	if len(data.Requests) > mgr.max {
+		data.Requests = data.Requests[len(data.Requests)-mgr.max:]
+	}
+
+	return mgr.save(to, data)
+}
+
+// 同意 from 的好友申请, 双方互加好友
+func (mgr *FriendMgr) Accept(name string, from string) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	data, err := mgr.load(name)
+	if err != nil {
+		return err
+	}
+	if indexOf(data.Requests, from) < 0 {
+		return ErrFriendNoRequest
+	}
+
+	other, err := mgr.load(from)
+	if err != nil {
+		return err
+	}
+	if len(data.Friends) >= mgr.max || len(other.Friends) >= mgr.max {
+		return ErrFriendFull
+	}
+
+	data.Requests = removeString(data.Requests, from)
+	if indexOf(data.Friends, from) < 0 {
+		data.Friends = append(data.Friends, from)
+	}
+	other.Requests = removeString(other.Requests, name)
+	if indexOf(other.Friends, name) < 0 {
+		other.Friends = append(other.Friends, name)
+	}
+
+	if err = mgr.save(name, data); err != nil {
+		return err
+	}
+	return mgr.save(from, other)
+}
+
+func (mgr *FriendMgr) Reject(name string, from string) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	data, err := mgr.load(name)
+	if err != nil {
+		return err
+	}
+	if indexOf(data.Requests, from) < 0 {
+		return ErrFriendNoRequest
+	}
+
+	data.Requests = removeString(data.Requests, from)
+
+	return mgr.save(name, data)
+}
+
+// 删除好友, 双方同时解除好友关系
+func (mgr *FriendMgr) Remove(name string, friend string) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	data, err := mgr.load(name)
+	if err != nil {
+		return err
+	}
+	if indexOf(data.Friends, friend) < 0 {
+		return ErrFriendNotExist
+	}
+
+	other, err := mgr.load(friend)
+	if err != nil {
+		return err
+	}
+
+	data.Friends = removeString(data.Friends, friend)
+	other.Friends = removeString(other.Friends, name)
+
+	if err = mgr.save(name, data); err != nil {
+		return err
+	}
+	return mgr.save(friend, other)
+}
+
+func friendInfo(name string, loc *proto.UserLocation) *proto.FriendInfo {
+	info := &proto.FriendInfo{
+		Name:   name,
+		Status: proto.FRIEND_STATUS_OFFLINE,
+	}
+	if loc != nil {
+		info.Status = proto.FRIEND_STATUS_ONLINE
+		if loc.Game != "" {
+			info.Status = proto.FRIEND_STATUS_IN_GAME
+			info.Game = loc.Game
+		}
+	}
+	return info
+}
+
+// 查询一组用户的在线状态
+func (mgr *FriendMgr) Infos(names []string) ([]*proto.FriendInfo, error) {
+	infos := make([]*proto.FriendInfo, 0, len(names))
+	if len(names) == 0 {
+		return infos, nil
+	}
+
+	users, err := lookupUsers(names)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		infos = append(infos, friendInfo(name, users[name]))
+	}
+	return infos, nil
+}
+
+func (mgr *FriendMgr) Info(name string) *proto.FriendInfo {
+	infos, err := mgr.Infos([]string{name})
+	if err != nil || len(infos) == 0 {
+		return friendInfo(name, nil)
+	}
+	return infos[0]
+}
+
+// 通知在线好友 name 的状态变化, loc 为 nil 表示下线
+func (mgr *FriendMgr) NotifyStatus(name string, loc *proto.UserLocation) {
+	data, err := mgr.Get(name)
+	if err != nil {
+		log.Error("FriendMgr NotifyStatus %v load failed: %v", name, err)
+		return
+	}
+	if len(data.Friends) == 0 {
+		return
+	}
+
+	online, err := lookupUsers(data.Friends)
+	if err != nil {
+		log.Error("FriendMgr NotifyStatus %v lookupUsers failed: %v", name, err)
+		return
+	}
+
+	notify := &proto.PlazaFriendStatusNotify{
+		Friend: friendInfo(name, loc),
+	}
+	for friend := range online {
+		deliverToUser(friend, proto.CMD_PLAZA_FRIEND_STATUS_NOTIFY, notify)
+	}
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"fmt"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+	"time"
+)
+
+func onPlazaAdminBanAddReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaAdminBanAddReq{}
+		rsp = &proto.PlazaAdminBanAddRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || req.Duration < 0 {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ADMIN_BAN_ADD_RSP, rsp))
+		return
+	}
+
+	ban := &proto.BanInfo{
+		Type:     req.Type,
+		Target:   req.Target,
+		Reason:   req.Reason,
+		Operator: router.Session(client).Name(),
+	}
+	if req.Duration > 0 {
+		ban.Expire = time.Now().Unix() + req.Duration
+	}
+
+	if err = banMgr.Add(ban); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	} else {
+		rsp.Ban = ban
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ADMIN_BAN_ADD_RSP, rsp))
+}
+
+func onPlazaAdminBanListReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		rsp = &proto.PlazaAdminBanListRsp{}
+	)
+
+	rsp.Bans = banMgr.List()
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ADMIN_BAN_LIST_RSP, rsp))
+}
+
+func onPlazaAdminBanLiftReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaAdminBanLiftReq{}
+		rsp = &proto.PlazaAdminBanLiftRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ADMIN_BAN_LIFT_RSP, rsp))
+		return
+	}
+
+	if err = banMgr.Lift(req.Id); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ADMIN_BAN_LIFT_RSP, rsp))
+
+	log.Info("onPlazaAdminBanLiftReq by %v: %v, %v", router.Session(client).Name(), req.Id, err)
+}
+
+func onPlazaAdminMaintenanceReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaAdminMaintenanceReq{}
+		rsp = &proto.PlazaAdminMaintenanceRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || req.KickDelay < 0 {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ADMIN_MAINTENANCE_RSP, rsp))
+		return
+	}
+
+	if err = setMaintenance(req.MaintenanceInfo); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ADMIN_MAINTENANCE_RSP, rsp))
+
+	log.Info("onPlazaAdminMaintenanceReq by %v: %v, %v", router.Session(client).Name(), string(msg.Body()), err)
+}
+
+func onPlazaAdminMailSendReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err  error
+		mail *proto.Mail
+		req  = &proto.PlazaAdminMailSendReq{}
+		rsp  = &proto.PlazaAdminMailSendRsp{}
+	)
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || req.Duration < 0 {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ADMIN_MAIL_SEND_RSP, rsp))
+		return
+	}
+
+	if mail, err = newMail(req.Title, req.Content, req.Attachments, req.Duration); err == nil {
+		if len(req.To) == 0 {
+			err = mailMgr.Broadcast(mail)
+		} else {
+			for _, name := range req.To {
+				if err = mailMgr.Send(name, mail); err != nil {
+					err = fmt.Errorf("%v: %v", name, err)
+					break
+				}
+			}
+		}
+	}
+
+	if err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	} else {
+		rsp.Id = mail.Id
+	}
+
+	log.Info("onPlazaAdminMailSendReq by %v, to: %v, title: '%v', attachments: %v, err: %v", router.Session(client).Name(), req.To, req.Title, req.Attachments, err)
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ADMIN_MAIL_SEND_RSP, rsp))
+}
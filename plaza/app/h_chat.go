@@ -0,0 +1,98 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+func onPlazaChatJoinReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaChatJoinReq{}
+		rsp = &proto.PlazaChatJoinRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_CHAT_JOIN_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_CHAT_JOIN_RSP, rsp))
+		return
+	}
+
+	rsp.Channel = req.Channel
+	rsp.History, err = chatMgr.Join(name, req.Channel)
+	if err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_CHAT_JOIN_RSP, rsp))
+}
+
+func onPlazaChatLeaveReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaChatLeaveReq{}
+		rsp = &proto.PlazaChatLeaveRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_CHAT_LEAVE_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_CHAT_LEAVE_RSP, rsp))
+		return
+	}
+
+	rsp.Channel = req.Channel
+	if err = chatMgr.Leave(name, req.Channel); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_CHAT_LEAVE_RSP, rsp))
+}
+
+func onPlazaChatSendReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaChatSendReq{}
+		rsp = &proto.PlazaChatSendRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_CHAT_SEND_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_CHAT_SEND_RSP, rsp))
+		return
+	}
+
+	if rsp.Code, err = chatMgr.Send(name, req); err != nil {
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_CHAT_SEND_RSP, rsp))
+}
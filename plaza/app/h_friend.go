@@ -0,0 +1,130 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+func onPlazaFriendListReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		rsp = &proto.PlazaFriendListRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_FRIEND_LIST_RSP, rsp))
+		return
+	}
+
+	data, err := friendMgr.Get(name)
+	if err == nil {
+		rsp.Requests = data.Requests
+		rsp.Friends, err = friendMgr.Infos(data.Friends)
+	}
+	if err != nil {
+		log.Error("onPlazaFriendListReq %v failed: %v", name, err)
+		rsp.Code = -1
+		rsp.Msg = "load failed"
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_FRIEND_LIST_RSP, rsp))
+}
+
+// 好友操作请求的通用处理: 检查登录、解析请求, 由 handler 完成具体操作
+func handleFriendReq(client *net.TcpClient, msg net.IMessage, rspCmd uint32, handler func(name string, req *proto.PlazaFriendReq, rsp *proto.PlazaFriendRsp) error) {
+	var (
+		err error
+		req = &proto.PlazaFriendReq{}
+		rsp = &proto.PlazaFriendRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(rspCmd, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || req.Name == "" {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(rspCmd, rsp))
+		return
+	}
+
+	if err = handler(name, req, rsp); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(rspCmd, rsp))
+}
+
+func onPlazaFriendAddReq(client *net.TcpClient, msg net.IMessage) {
+	handleFriendReq(client, msg, proto.CMD_PLAZA_FRIEND_ADD_RSP, func(name string, req *proto.PlazaFriendReq, rsp *proto.PlazaFriendRsp) error {
+		if err := friendMgr.Request(name, req.Name); err != nil {
+			return err
+		}
+
+		deliverToUser(req.Name, proto.CMD_PLAZA_FRIEND_REQUEST_NOTIFY, &proto.PlazaFriendRequestNotify{Name: name})
+
+		log.Info("friend request: %v -> %v", name, req.Name)
+
+		return nil
+	})
+}
+
+func onPlazaFriendAcceptReq(client *net.TcpClient, msg net.IMessage) {
+	handleFriendReq(client, msg, proto.CMD_PLAZA_FRIEND_ACCEPT_RSP, func(name string, req *proto.PlazaFriendReq, rsp *proto.PlazaFriendRsp) error {
+		if err := friendMgr.Accept(name, req.Name); err != nil {
+			return err
+		}
+
+		rsp.Friend = friendMgr.Info(req.Name)
+
+		deliverToUser(req.Name, proto.CMD_PLAZA_FRIEND_CHANGE_NOTIFY, &proto.PlazaFriendChangeNotify{
+			Event:  proto.FRIEND_EVENT_ACCEPTED,
+			Friend: friendMgr.Info(name),
+		})
+
+		log.Info("friend accept: %v <- %v", name, req.Name)
+
+		return nil
+	})
+}
+
+func onPlazaFriendRejectReq(client *net.TcpClient, msg net.IMessage) {
+	handleFriendReq(client, msg, proto.CMD_PLAZA_FRIEND_REJECT_RSP, func(name string, req *proto.PlazaFriendReq, rsp *proto.PlazaFriendRsp) error {
+		if err := friendMgr.Reject(name, req.Name); err != nil {
+			return err
+		}
+
+		deliverToUser(req.Name, proto.CMD_PLAZA_FRIEND_CHANGE_NOTIFY, &proto.PlazaFriendChangeNotify{
+			Event:  proto.FRIEND_EVENT_REJECTED,
+			Friend: &proto.FriendInfo{Name: name},
+		})
+
+		return nil
+	})
+}
+
+func onPlazaFriendRemoveReq(client *net.TcpClient, msg net.IMessage) {
+	handleFriendReq(client, msg, proto.CMD_PLAZA_FRIEND_REMOVE_RSP, func(name string, req *proto.PlazaFriendReq, rsp *proto.PlazaFriendRsp) error {
+		if err := friendMgr.Remove(name, req.Name); err != nil {
+			return err
+		}
+
+		deliverToUser(req.Name, proto.CMD_PLAZA_FRIEND_CHANGE_NOTIFY, &proto.PlazaFriendChangeNotify{
+			Event:  proto.FRIEND_EVENT_REMOVED,
+			Friend: &proto.FriendInfo{Name: name},
+		})
+
+		log.Info("friend remove: %v -> %v", name, req.Name)
+
+		return nil
+	})
+}
@@ -1,20 +1,17 @@
 package app
 
 import (
-	"fmt"
 	"github.com/nothollyhigh/kiss/log"
 	"github.com/nothollyhigh/kiss/net"
+	"github.com/nothollyhigh/kiss/util"
 	"kisscluster/proto"
-	"sync/atomic"
-)
-
-var (
-	count int64 = 0
+	"kisscluster/session"
 )
 
 func onPlazaLoginReq(client *net.TcpClient, msg net.IMessage) {
 	var (
 		err error
+		acc *Account
 		req = &proto.PlazaLoginReq{}
 		rsp = &proto.PlazaLoginRsp{}
 	)
@@ -26,17 +23,219 @@ func onPlazaLoginReq(client *net.TcpClient, msg net.IMessage) {
 		return
 	}
 
-	rsp.Msg = "登录成功"
-	rsp.Name = fmt.Sprintf("guest_%v", atomic.AddInt64(&count, 1))
+	// 已登录的连接不能再次登录, 否则会重复登记在线用户和 IP 计数
+	if router.Session(client).Authed() {
+		rsp.Code = -1
+		rsp.Msg = "already logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp))
+		return
+	}
+
+	update := checkClientVersion(req.Platform, req.Version)
+	rsp.Update, rsp.UpdateUrl = update.Update, update.Url
+	if update.Update == proto.UPDATE_FORCE {
+		log.Info("onPlazaLoginReq '%v' failed: client version '%v' on '%v' too old", req.Account, req.Version, req.Platform)
+		rsp.Code = proto.CODE_FORCE_UPDATE
+		rsp.Msg = "客户端版本过低, 请更新"
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp), userMgr.KickClient)
+		return
+	}
+
+	ip := router.Session(client).Ip()
+	if rsp.Code, err = ipLimiter.Check(ip); err != nil {
+		log.Info("onPlazaLoginReq '%v' from %v failed: %v", req.Account, ip, err)
+		rsp.Msg = err.Error()
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp), userMgr.KickClient)
+		return
+	}
+
+	if ban, banned := banMgr.CheckIp(ip); banned {
+		log.Info("onPlazaLoginReq '%v' from %v failed: ip banned", req.Account, ip)
+		rsp.Code = proto.CODE_BANNED
+		rsp.Msg = ban.Reason
+		rsp.Ban = ban
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp), userMgr.KickClient)
+		return
+	}
+
+	if req.Provider != "" {
+		acc, err = externalLogin(req.Provider, req.Token, ip)
+	} else if req.Account == "" {
+		acc, err = accountMgr.GuestLogin(req.DeviceId, ip)
+	} else {
+		acc, err = accountMgr.Login(req.Account, req.Passwd, ip)
+	}
+	if err != nil {
+		log.Info("onPlazaLoginReq '%v' from %v failed: %v", req.Account, ip, err)
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp), userMgr.KickClient)
+		return
+	}
+
+	if ban, banned := banMgr.CheckAccount(acc.Name); banned {
+		log.Info("onPlazaLoginReq %v from %v failed: account banned", acc.Name, ip)
+		rsp.Code = proto.CODE_BANNED
+		rsp.Msg = ban.Reason
+		rsp.Ban = ban
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp), userMgr.KickClient)
+		return
+	}
+
+	if info, blocked := maintenance.Blocked(acc); blocked {
+		log.Info("onPlazaLoginReq %v from %v failed: maintenance", acc.Name, ip)
+		rsp.Code = proto.CODE_MAINTENANCE
+		rsp.Msg = info.Msg
+		rsp.Maintenance = info
+		rsp.Maintenance.Whitelist = nil
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp), userMgr.KickClient)
+		return
+	}
+
+	code, position := loginQueue.Enter(acc, client, update)
+	switch code {
+	case proto.CODE_OK:
+		completeLogin(client, acc, update)
+	case proto.CODE_LOGIN_QUEUED:
+		rsp.Code = code
+		rsp.Msg = "排队中"
+		rsp.Name = acc.Name
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp))
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_LOGIN_QUEUE_NOTIFY, &proto.PlazaLoginQueueNotify{
+			Position: position,
+			Wait:     loginQueue.Estimate(position),
+		}))
+		log.Info("onPlazaLoginReq %v queued, position: %v", acc.Name, position)
+	default:
+		rsp.Code = code
+		rsp.Msg = "服务器已满"
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp), userMgr.KickClient)
+		log.Info("onPlazaLoginReq %v failed: server full", acc.Name)
+	}
+}
+
+// 登录成功, 加入在线用户
+func completeLogin(client *net.TcpClient, acc *Account, update *ClientUpdate) {
+	var (
+		name = acc.Name
+		ip   = router.Session(client).Ip()
+		rsp  = &proto.PlazaLoginRsp{
+			Msg:       "登录成功",
+			Name:      name,
+			Update:    update.Update,
+			UpdateUrl: update.Url,
+		}
+	)
 
-	userMgr.Add(rsp.Name, client)
+	// 排队期间可能被封禁
+	ban, banned := banMgr.CheckAccount(name)
+	if !banned {
+		ban, banned = banMgr.CheckIp(ip)
+	}
+	if banned {
+		loginQueue.Done(client)
+		log.Info("completeLogin %v from %v failed: banned", name, ip)
+		rsp.Code = proto.CODE_BANNED
+		rsp.Msg = ban.Reason
+		rsp.Ban = ban
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp), userMgr.KickClient)
+		return
+	}
+
+	profile, err := profileMgr.Login(acc)
+	if err != nil {
+		log.Error("completeLogin %v load profile failed: %v", name, err)
+	}
+	rsp.Profile = profile
+
+	userMgr.Add(name, client)
+	loginQueue.Done(client)
+	router.Session(client).Auth(name, accountRole(acc))
+	ipLimiter.Online(ip)
+	registerUser(name)
 	client.OnClose("disconnected", func(*net.TcpClient) {
-		userMgr.Delete(rsp.Name)
+		ipLimiter.Offline(ip)
+		if !userMgr.Delete(name, client) {
+			return
+		}
+		unregisterUser(name)
+		chatMgr.RemoveUser(name)
+		matchMgr.RemoveUser(name)
+		util.Go(func() {
+			friendMgr.NotifyStatus(name, nil)
+			loginQueue.Admit()
+		})
 	})
 
 	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_LOGIN_RSP, rsp))
 
-	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_GAME_LIST_NOTIFY, gameList))
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_GAME_LIST_NOTIFY, getGameList()))
+
+	util.Go(func() {
+		friendMgr.NotifyStatus(name, &proto.UserLocation{Name: name, Plaza: config.SvrID})
+	})
+
+	log.Info("onPlazaLoginReq success: %v, ip: %v", name, ip)
+}
+
+// 第三方登录: 由对应平台验证 token, 再映射到本地账号
+func externalLogin(name string, token string, ip string) (*Account, error) {
+	provider, err := getAuthProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	externalId, err := provider.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return accountMgr.ExternalLogin(name, externalId, ip)
+}
+
+// 配置的管理员账号拥有管理员角色
+func accountRole(acc *Account) int {
+	for _, name := range config.Admins {
+		if !acc.Guest && (name == acc.Name || name == acc.Login) {
+			return session.ROLE_ADMIN
+		}
+	}
+	return session.ROLE_USER
+}
+
+func onPlazaAccountBindReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaAccountBindReq{}
+		rsp = &proto.PlazaAccountBindRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ACCOUNT_BIND_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ACCOUNT_BIND_RSP, rsp))
+		return
+	}
+
+	if _, err = accountMgr.Bind(name, req.Account, req.Passwd); err != nil {
+		log.Info("onPlazaAccountBindReq %v -> '%v' failed: %v", name, req.Account, err)
+		rsp.Code = -1
+		if err == ErrAccountUsed {
+			rsp.Code = proto.CODE_ACCOUNT_USED
+		}
+		rsp.Msg = err.Error()
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ACCOUNT_BIND_RSP, rsp))
+		return
+	}
+
+	rsp.Account = req.Account
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_ACCOUNT_BIND_RSP, rsp))
 
-	log.Info("onPlazaLoginReq success: %v", rsp.Name)
+	log.Info("onPlazaAccountBindReq %v bound to '%v'", name, req.Account)
 }
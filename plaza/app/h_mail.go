@@ -0,0 +1,121 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+func onPlazaMailListReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		rsp = &proto.PlazaMailListRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_LIST_RSP, rsp))
+		return
+	}
+
+	if rsp.Mails, err = mailMgr.List(name); err != nil {
+		log.Error("onPlazaMailListReq %v failed: %v", name, err)
+		rsp.Code = -1
+		rsp.Msg = "load failed"
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_LIST_RSP, rsp))
+}
+
+func onPlazaMailReadReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaMailReq{}
+		rsp = &proto.PlazaMailRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_READ_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || req.Id == "" {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_READ_RSP, rsp))
+		return
+	}
+
+	if rsp.Mail, err = mailMgr.Read(name, req.Id); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_READ_RSP, rsp))
+}
+
+func onPlazaMailClaimReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaMailReq{}
+		rsp = &proto.PlazaMailClaimRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_CLAIM_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || req.Id == "" {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_CLAIM_RSP, rsp))
+		return
+	}
+
+	if rsp.Mail, rsp.Assets, err = mailMgr.Claim(name, req.Id); err != nil {
+		log.Info("onPlazaMailClaimReq %v %v failed: %v", name, req.Id, err)
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_CLAIM_RSP, rsp))
+}
+
+func onPlazaMailDeleteReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaMailReq{}
+		rsp = &proto.PlazaMailRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_DELETE_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || req.Id == "" {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_DELETE_RSP, rsp))
+		return
+	}
+
+	if err = mailMgr.Delete(name, req.Id); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MAIL_DELETE_RSP, rsp))
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+func onPlazaMatchReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaMatchReq{}
+		rsp = &proto.PlazaMatchRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MATCH_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MATCH_RSP, rsp))
+		return
+	}
+
+	rsp.Kind = req.Kind
+	if err = matchMgr.Enqueue(name, req.Kind, req.Rating); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MATCH_RSP, rsp))
+}
+
+func onPlazaMatchCancelReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		rsp = &proto.PlazaMatchCancelRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MATCH_CANCEL_RSP, rsp))
+		return
+	}
+
+	if err := matchMgr.Cancel(name); err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MATCH_CANCEL_RSP, rsp))
+}
+
+func onPlazaWatchReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaWatchReq{}
+		rsp = &proto.PlazaWatchRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_WATCH_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || (req.Name == "" && (req.Game == "" || req.RoomId == "")) {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_WATCH_RSP, rsp))
+		return
+	}
+
+	rsp.Game = req.Game
+	if req.Name != "" {
+		// 只能按名字观战好友
+		if isFriend, err := friendMgr.IsFriend(name, req.Name); err != nil || !isFriend {
+			log.Info("onPlazaWatchReq %v watch %v failed: not friends, err: %v", name, req.Name, err)
+			rsp.Code = -1
+			rsp.Msg = ErrFriendNotExist.Error()
+			client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_WATCH_RSP, rsp))
+			return
+		}
+		users, err := lookupUsers([]string{req.Name})
+		if err != nil || users[req.Name] == nil || users[req.Name].Game == "" {
+			rsp.Code = proto.CODE_USER_OFFLINE
+			rsp.Msg = "user not in game"
+			client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_WATCH_RSP, rsp))
+			return
+		}
+		rsp.Game = users[req.Name].Game
+	}
+
+	info, ok := getGame(rsp.Game)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "game server not found"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_WATCH_RSP, rsp))
+		return
+	}
+
+	rsp.Addr = info.ClientAddr
+	if rsp.Ticket, err = reserveWatch(name, rsp.Game, req.RoomId, req.Name); err != nil {
+		log.Error("onPlazaWatchReq %v watch %v failed: %v", name, req, err)
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_WATCH_RSP, rsp))
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+func onPlazaProfileGetReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaProfileGetReq{}
+		rsp = &proto.PlazaProfileGetRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_PROFILE_GET_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_PROFILE_GET_RSP, rsp))
+		return
+	}
+
+	if req.Name == "" || req.Name == name {
+		rsp.Profile, err = profileMgr.Get(name)
+	} else if rsp.Profile, err = profileMgr.Get(req.Name); err == nil {
+		rsp.Profile = publicProfile(rsp.Profile)
+	}
+	if err != nil {
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_PROFILE_GET_RSP, rsp))
+}
+
+func onPlazaProfileUpdateReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaProfileUpdateReq{}
+		rsp = &proto.PlazaProfileUpdateRsp{}
+	)
+
+	name, ok := userMgr.GetName(client)
+	if !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_PROFILE_UPDATE_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_PROFILE_UPDATE_RSP, rsp))
+		return
+	}
+
+	if rsp.Profile, err = profileMgr.Update(name, req); err != nil {
+		log.Info("onPlazaProfileUpdateReq %v failed: %v", name, err)
+		rsp.Code = -1
+		rsp.Msg = err.Error()
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_PROFILE_UPDATE_RSP, rsp))
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+)
+
+const (
+	userLookupMax = 100
+)
+
+func onPlazaUserLookupReq(client *net.TcpClient, msg net.IMessage) {
+	var (
+		err error
+		req = &proto.PlazaUserLookupReq{}
+		rsp = &proto.PlazaUserLookupRsp{}
+	)
+
+	if _, ok := userMgr.GetName(client); !ok {
+		rsp.Code = -1
+		rsp.Msg = "not logged in"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_USER_LOOKUP_RSP, rsp))
+		return
+	}
+
+	if err = json.Unmarshal(msg.Body(), req); err != nil || len(req.Names) > userLookupMax {
+		rsp.Code = -1
+		rsp.Msg = "invaid json"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_USER_LOOKUP_RSP, rsp))
+		return
+	}
+
+	users, err := lookupUsers(req.Names)
+	if err != nil {
+		log.Error("onPlazaUserLookupReq lookupUsers failed: %v", err)
+		rsp.Code = -1
+		rsp.Msg = "lookup failed"
+		client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_USER_LOOKUP_RSP, rsp))
+		return
+	}
+
+	for _, name := range req.Names {
+		status := &proto.PlazaUserStatus{Name: name}
+		if loc, ok := users[name]; ok {
+			status.Online = true
+			status.Plaza = loc.Plaza
+			status.Game = loc.Game
+		}
+		rsp.Users = append(rsp.Users, status)
+	}
+
+	client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_USER_LOOKUP_RSP, rsp))
+}
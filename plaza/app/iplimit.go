@@ -0,0 +1,104 @@
+package app
+
+import (
+	"errors"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"kisscluster/session"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ipLimiter = &IpLimiter{
+		online: map[string]int{},
+		logins: map[string][]time.Time{},
+	}
+
+	ErrIpBanned       = errors.New("ip banned")
+	ErrIpTooMany      = errors.New("too many users from this ip")
+	ErrIpLoginTooFast = errors.New("login too frequently")
+)
+
+// 按客户端真实 IP 限制同时在线人数和登录频率, 并拒绝封禁的 IP
+type IpLimiter struct {
+	sync.Mutex
+	banned []*net.IPNet
+	online map[string]int
+	logins map[string][]time.Time
+}
+
+func (limiter *IpLimiter) init() {
+	banned, err := session.ParseNets(config.BannedIps)
+	if err != nil {
+		log.Panic("IpLimiter init BannedIps failed: %v", err)
+	}
+	limiter.banned = banned
+
+	util.Go(func() {
+		for {
+			time.Sleep(time.Minute)
+			limiter.clearExpired(time.Now())
+		}
+	})
+}
+
+// 登录前检查, 通过时记录一次登录
+func (limiter *IpLimiter) Check(ip string) (int, error) {
+	if session.ContainsIp(limiter.banned, ip) {
+		return proto.CODE_BANNED, ErrIpBanned
+	}
+
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if config.MaxOnlinePerIp > 0 && limiter.online[ip] >= config.MaxOnlinePerIp {
+		return proto.CODE_ERROR, ErrIpTooMany
+	}
+
+	if config.LoginRatePerIp > 0 {
+		now := time.Now()
+		logins := limiter.logins[ip]
+		for len(logins) > 0 && now.Sub(logins[0]) >= time.Minute {
+			logins = logins[1:]
+		}
+		if len(logins) >= config.LoginRatePerIp {
+			limiter.logins[ip] = logins
+			return proto.CODE_ERROR, ErrIpLoginTooFast
+		}
+		limiter.logins[ip] = append(logins, now)
+	}
+
+	return proto.CODE_OK, nil
+}
+
+func (limiter *IpLimiter) Online(ip string) {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	limiter.online[ip]++
+}
+
+func (limiter *IpLimiter) Offline(ip string) {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if limiter.online[ip] <= 1 {
+		delete(limiter.online, ip)
+	} else {
+		limiter.online[ip]--
+	}
+}
+
+func (limiter *IpLimiter) clearExpired(now time.Time) {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	for ip, logins := range limiter.logins {
+		if len(logins) == 0 || now.Sub(logins[len(logins)-1]) >= time.Minute {
+			delete(limiter.logins, ip)
+		}
+	}
+}
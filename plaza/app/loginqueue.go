@@ -0,0 +1,193 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"sync"
+	"time"
+)
+
+const (
+	loginQueueNotifyInterval = time.Second * 3
+)
+
+var (
+	loginQueue = &LoginQueue{
+		admitting: map[*net.TcpClient]bool{},
+	}
+)
+
+type loginWaiter struct {
+	acc      *Account
+	client   *net.TcpClient
+	update   *ClientUpdate
+	enqueued time.Time
+}
+
+// 在线人数达到 MaxOnline 后的登录排队, 先进先出
+type LoginQueue struct {
+	sync.Mutex
+	waiters   []*loginWaiter
+	admitting map[*net.TcpClient]bool // 已放行但还未完成登录的连接, 占用在线名额
+
+	lastAdmit   time.Time
+	avgInterval time.Duration // 放行间隔的滑动平均, 用于估算等待时间
+}
+
+// 空闲的在线名额, 调用时需持有锁
+func (queue *LoginQueue) free() int {
+	return config.MaxOnline - userMgr.Count() - len(queue.admitting)
+}
+
+func (queue *LoginQueue) full() bool {
+	return config.MaxOnline > 0 && queue.free() <= 0
+}
+
+// 白名单和 VIP 不排队
+func (queue *LoginQueue) bypass(acc *Account) bool {
+	if acc.Vip {
+		return true
+	}
+	for _, name := range config.LoginWhitelist {
+		if name == acc.Name || (acc.Login != "" && name == acc.Login) {
+			return true
+		}
+	}
+	// 已在线的用户重复登录会替换旧连接, 不增加在线人数
+	_, online := userMgr.Get(acc.Name)
+	return online
+}
+
+// 检查是否可以直接登录, 不能时加入队列并返回排队位置, 队列已满返回 CODE_SERVER_FULL
+func (queue *LoginQueue) Enter(acc *Account, client *net.TcpClient, update *ClientUpdate) (code int, position int) {
+	if queue.bypass(acc) {
+		return proto.CODE_OK, 0
+	}
+
+	queue.Lock()
+	defer queue.Unlock()
+
+	if len(queue.waiters) == 0 && !queue.full() {
+		queue.admitting[client] = true
+		return proto.CODE_OK, 0
+	}
+
+	for i, w := range queue.waiters {
+		if w.client == client {
+			return proto.CODE_LOGIN_QUEUED, i + 1
+		}
+	}
+
+	if config.LoginQueueMax > 0 && len(queue.waiters) >= config.LoginQueueMax {
+		return proto.CODE_SERVER_FULL, 0
+	}
+
+	queue.waiters = append(queue.waiters, &loginWaiter{
+		acc:      acc,
+		client:   client,
+		update:   update,
+		enqueued: time.Now(),
+	})
+	client.OnClose("loginqueue", func(*net.TcpClient) {
+		queue.remove(client)
+	})
+
+	return proto.CODE_LOGIN_QUEUED, len(queue.waiters)
+}
+
+func (queue *LoginQueue) remove(client *net.TcpClient) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	delete(queue.admitting, client)
+
+	for i, w := range queue.waiters {
+		if w.client == client {
+			queue.waiters = append(queue.waiters[:i], queue.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// 登录完成或失败, 释放占用的名额
+func (queue *LoginQueue) Done(client *net.TcpClient) {
+	queue.Lock()
+	defer queue.Unlock()
+
+	delete(queue.admitting, client)
+}
+
+// 有空位时按顺序放行, 放行的连接在登录完成前占用名额, 并发调用不会超过 MaxOnline
+func (queue *LoginQueue) Admit() {
+	var admitted []*loginWaiter
+
+	queue.Lock()
+	now := time.Now()
+	for len(queue.waiters) > 0 && queue.free() > 0 {
+		w := queue.waiters[0]
+		admitted = append(admitted, w)
+		queue.waiters = queue.waiters[1:]
+		queue.admitting[w.client] = true
+
+		if !queue.lastAdmit.IsZero() {
+			interval := now.Sub(queue.lastAdmit)
+			if queue.avgInterval == 0 {
+				queue.avgInterval = interval
+			} else {
+				queue.avgInterval = (queue.avgInterval*7 + interval) / 8
+			}
+		}
+		queue.lastAdmit = now
+	}
+	queue.Unlock()
+
+	for _, w := range admitted {
+		log.Info("LoginQueue admit %v, waited %v", w.acc.Name, now.Sub(w.enqueued))
+		completeLogin(w.client, w.acc, w.update)
+	}
+}
+
+// 预计等待秒数, 未知时返回 -1
+func (queue *LoginQueue) Estimate(position int) int {
+	queue.Lock()
+	defer queue.Unlock()
+
+	return queue.estimate(position)
+}
+
+// 调用时需持有锁
+func (queue *LoginQueue) estimate(position int) int {
+	if queue.avgInterval <= 0 {
+		return -1
+	}
+	return int((queue.avgInterval*time.Duration(position) + time.Second - 1) / time.Second)
+}
+
+// 推送排队进度
+func (queue *LoginQueue) Notify() {
+	queue.Lock()
+	defer queue.Unlock()
+
+	for i, w := range queue.waiters {
+		w.client.SendMsg(proto.NewMessage(proto.CMD_PLAZA_LOGIN_QUEUE_NOTIFY, &proto.PlazaLoginQueueNotify{
+			Position: i + 1,
+			Wait:     queue.estimate(i + 1),
+		}))
+	}
+}
+
+func (queue *LoginQueue) run() {
+	util.Go(func() {
+		lastNotify := time.Now()
+		for {
+			time.Sleep(time.Second)
+			queue.Admit()
+			if time.Since(lastNotify) >= loginQueueNotifyInterval {
+				queue.Notify()
+				lastNotify = time.Now()
+			}
+		}
+	})
+}
@@ -0,0 +1,333 @@
+package app
+
+import (
+	"errors"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	bucketMail          = "mail"           // 用户名 -> 邮箱
+	bucketMailBroadcast = "mail_broadcast" // 邮件 ID -> 全服邮件
+
+	mailFromSystem = "system"
+)
+
+var (
+	mailMgr = &MailMgr{broadcasts: map[string]*proto.Mail{}}
+
+	ErrMailNotExist     = errors.New("mail not exist")
+	ErrMailNoAttachment = errors.New("mail has no attachment")
+	ErrMailNotClaimed   = errors.New("attachments not claimed")
+	ErrMailClaimed      = errors.New("attachments already claimed")
+	ErrMailInvalid      = errors.New("invalid mail")
+)
+
+// 邮箱, Received 记录已收取的全服邮件 ID
+type Mailbox struct {
+	Mails    []*proto.Mail `json:"mails"`
+	Received []string      `json:"received"`
+}
+
+func mailExpired(mail *proto.Mail, now int64) bool {
+	return mail.Expire > 0 && mail.Expire <= now
+}
+
+// 邮件, 个人邮件直接写入收件人邮箱, 全服邮件单独存储, 用户读取邮箱时收取
+type MailMgr struct {
+	sync.Mutex
+
+	max        int
+	broadcasts map[string]*proto.Mail
+}
+
+func (mgr *MailMgr) init() {
+	mgr.max = config.MailMax
+	if mgr.max <= 0 {
+		mgr.max = 100
+	}
+
+	mgr.Lock()
+	mgr.loadBroadcasts(false)
+	mgr.Unlock()
+
+	// 多个大厅共享存储, 定时加载其他大厅发送的全服邮件
+	interval := time.Second * time.Duration(config.MailRefresh)
+	if interval <= 0 {
+		interval = time.Second * 30
+	}
+	util.Go(func() {
+		for {
+			time.Sleep(interval)
+			mgr.Lock()
+			mgr.loadBroadcasts(true)
+			mgr.Unlock()
+		}
+	})
+}
+
+func (mgr *MailMgr) loadBroadcasts(notify bool) {
+	ids, err := store.Keys(bucketMailBroadcast)
+	if err != nil {
+		log.Error("MailMgr loadBroadcasts failed: %v", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	exist := map[string]bool{}
+	for _, id := range ids {
+		exist[id] = true
+		mail, ok := mgr.broadcasts[id]
+		if !ok {
+			mail = &proto.Mail{}
+			if ok, err = store.Get(bucketMailBroadcast, id, mail); err != nil || !ok {
+				continue
+			}
+		}
+		if mailExpired(mail, now) {
+			store.Delete(bucketMailBroadcast, id)
+			delete(mgr.broadcasts, id)
+			continue
+		}
+		if _, loaded := mgr.broadcasts[id]; !loaded {
+			mgr.broadcasts[id] = mail
+			if notify {
+				userMgr.Broadcast(proto.NewMessage(proto.CMD_PLAZA_MAIL_NEW_NOTIFY, &proto.PlazaMailNewNotify{Mail: mail}))
+			}
+		}
+	}
+	for id := range mgr.broadcasts {
+		if !exist[id] {
+			delete(mgr.broadcasts, id)
+		}
+	}
+}
+
+// 加载邮箱, 收取新的全服邮件并清理过期邮件, 返回邮箱是否有变化
+func (mgr *MailMgr) load(name string) (*Mailbox, bool, error) {
+	box := &Mailbox{}
+	if _, err := store.Get(bucketMail, name, box); err != nil {
+		return nil, false, err
+	}
+
+	var (
+		changed  bool
+		now      = time.Now().Unix()
+		received = []string{}
+	)
+
+	for _, id := range box.Received {
+		if _, ok := mgr.broadcasts[id]; ok {
+			received = append(received, id)
+		} else {
+			changed = true
+		}
+	}
+	for id, mail := range mgr.broadcasts {
+		if indexOf(received, id) < 0 && !mailExpired(mail, now) {
+			m := *mail
+			box.Mails = append(box.Mails, &m)
+			received = append(received, id)
+			changed = true
+		}
+	}
+	box.Received = received
+
+	mails := box.Mails[:0]
+	for _, mail := range box.Mails {
+		if mailExpired(mail, now) {
+			changed = true
+			continue
+		}
+		mails = append(mails, mail)
+	}
+	box.Mails = mails
+
+	if changed {
+		sort.SliceStable(box.Mails, func(i, j int) bool {
+			return box.Mails[i].Created < box.Mails[j].Created
+		})
+	}
+	if len(box.Mails) > mgr.max {
+		box.Mails = box.Mails[len(box.Mails)-mgr.max:]
+		changed = true
+	}
+
+	return box, changed, nil
+}
+
+func (mgr *MailMgr) save(name string, box *Mailbox) error {
+	return store.Put(bucketMail, name, box)
+}
+
+func (box *Mailbox) find(id string) (int, *proto.Mail) {
+	for i, mail := range box.Mails {
+		if mail.Id == id {
+			return i, mail
+		}
+	}
+	return -1, nil
+}
+
+func (mgr *MailMgr) List(name string) ([]*proto.Mail, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	box, changed, err := mgr.load(name)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		if err = mgr.save(name, box); err != nil {
+			return nil, err
+		}
+	}
+	return box.Mails, nil
+}
+
+func (mgr *MailMgr) Read(name string, id string) (*proto.Mail, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	box, _, err := mgr.load(name)
+	if err != nil {
+		return nil, err
+	}
+	_, mail := box.find(id)
+	if mail == nil {
+		return nil, ErrMailNotExist
+	}
+
+	mail.Read = true
+	return mail, mgr.save(name, box)
+}
+
+// 领取附件, 已领取的邮件直接返回; 以邮件 ID 作为资产变更 ID, 资产已增加但邮箱保存失败时,
+// 再次领取只补写领取标记, 不会重复增加资产
+func (mgr *MailMgr) Claim(name string, id string) (*proto.Mail, map[string]int64, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	box, _, err := mgr.load(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, mail := box.find(id)
+	if mail == nil {
+		return nil, nil, ErrMailNotExist
+	}
+	if len(mail.Attachments) == 0 {
+		return nil, nil, ErrMailNoAttachment
+	}
+	if mail.Claimed {
+		return nil, nil, ErrMailClaimed
+	}
+
+	profile, applied, err := profileMgr.AddAssets(name, "mail:"+id, mail.Attachments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mail.Read = true
+	mail.Claimed = true
+	if err = mgr.save(name, box); err != nil {
+		log.Error("MailMgr Claim %v: %v save mailbox failed: %v", name, id, err)
+		return nil, nil, err
+	}
+	if applied {
+		log.Info("MailMgr Claim %v: %v, %v", name, id, mail.Attachments)
+	}
+	return mail, profile.Assets, nil
+}
+
+// 删除邮件, 附件未领取的邮件不能删除
+func (mgr *MailMgr) Delete(name string, id string) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	box, _, err := mgr.load(name)
+	if err != nil {
+		return err
+	}
+	i, mail := box.find(id)
+	if mail == nil {
+		return ErrMailNotExist
+	}
+	if len(mail.Attachments) > 0 && !mail.Claimed {
+		return ErrMailNotClaimed
+	}
+
+	box.Mails = append(box.Mails[:i], box.Mails[i+1:]...)
+	return mgr.save(name, box)
+}
+
+func newMail(title string, content string, attachments map[string]int64, duration int64) (*proto.Mail, error) {
+	if title == "" {
+		return nil, ErrMailInvalid
+	}
+	for _, count := range attachments {
+		if count <= 0 {
+			return nil, ErrMailInvalid
+		}
+	}
+
+	now := time.Now().Unix()
+	mail := &proto.Mail{
+		Id:          randomId(8),
+		From:        mailFromSystem,
+		Title:       title,
+		Content:     content,
+		Attachments: attachments,
+		Created:     now,
+	}
+	if duration > 0 {
+		mail.Expire = now + duration
+	}
+	return mail, nil
+}
+
+// 发送个人邮件, 收件人在线时推送新邮件通知
+func (mgr *MailMgr) Send(name string, mail *proto.Mail) error {
+	if !accountMgr.Exist(name) {
+		return ErrAccountNotExist
+	}
+
+	mgr.Lock()
+	box, _, err := mgr.load(name)
+	if err == nil {
+		m := *mail
+		box.Mails = append(box.Mails, &m)
+		if len(box.Mails) > mgr.max {
+			box.Mails = box.Mails[len(box.Mails)-mgr.max:]
+		}
+		err = mgr.save(name, box)
+	}
+	mgr.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	deliverToUser(name, proto.CMD_PLAZA_MAIL_NEW_NOTIFY, &proto.PlazaMailNewNotify{Mail: mail})
+
+	return nil
+}
+
+// 发送全服邮件, 本大厅在线用户立即推送, 其他大厅定时加载后推送
+func (mgr *MailMgr) Broadcast(mail *proto.Mail) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if err := store.Put(bucketMailBroadcast, mail.Id, mail); err != nil {
+		return err
+	}
+	mgr.broadcasts[mail.Id] = mail
+
+	userMgr.Broadcast(proto.NewMessage(proto.CMD_PLAZA_MAIL_NEW_NOTIFY, &proto.PlazaMailNewNotify{Mail: mail}))
+
+	return nil
+}
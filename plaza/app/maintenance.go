@@ -0,0 +1,120 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"sync"
+	"time"
+)
+
+var (
+	maintenance = &Maintenance{}
+)
+
+// 中心服务器同步过来的停服维护状态
+type Maintenance struct {
+	sync.RWMutex
+	info proto.MaintenanceInfo
+	seq  int64
+}
+
+func (m *Maintenance) Get() proto.MaintenanceInfo {
+	m.RLock()
+	defer m.RUnlock()
+
+	return m.info
+}
+
+// 维护期间不在白名单中的账号不能登录
+func (m *Maintenance) Blocked(acc *Account) (*proto.MaintenanceInfo, bool) {
+	info := m.Get()
+	if !info.Active(time.Now().Unix()) || info.Allow(acc.Name, acc.Login) {
+		return nil, false
+	}
+	return &info, true
+}
+
+// 大厅重连中心服务器时会重发相同的状态, 只有 KickAt 变化时才重新开始踢人倒计时
+func (m *Maintenance) Update(info proto.MaintenanceInfo) {
+	now := time.Now().Unix()
+
+	m.Lock()
+	wasActive := m.info.Active(now)
+	restart := !wasActive || m.info.KickAt != info.KickAt
+	m.info = info
+	if restart {
+		m.seq++
+	}
+	seq := m.seq
+	m.Unlock()
+
+	if !info.Active(now) {
+		if wasActive {
+			m.broadcast(&info)
+			log.Info("Maintenance end")
+		}
+		return
+	}
+
+	if restart && info.KickAt > 0 {
+		util.Go(func() {
+			m.countdown(seq)
+		})
+	}
+	m.broadcast(&info)
+
+	log.Info("Maintenance start: %+v", info)
+}
+
+func (m *Maintenance) broadcast(info *proto.MaintenanceInfo) {
+	userMgr.Broadcast(proto.NewMessage(proto.CMD_PLAZA_MAINTENANCE_NOTIFY, &proto.PlazaMaintenanceNotify{
+		Enabled: info.Active(time.Now().Unix()),
+		Msg:     info.Msg,
+		EndTime: info.EndTime,
+		KickAt:  info.KickAt,
+	}))
+}
+
+// 踢人倒计时, 每分钟及最后 10 秒每秒广播一次, 期间维护结束或踢人时间变化则取消
+func (m *Maintenance) countdown(seq int64) {
+	for {
+		time.Sleep(time.Second)
+
+		m.RLock()
+		cur, info := m.seq, m.info
+		m.RUnlock()
+
+		now := time.Now().Unix()
+		if cur != seq || !info.Active(now) {
+			return
+		}
+
+		remain := info.KickAt - now
+		if remain <= 0 {
+			m.kick(&info)
+			return
+		}
+		if remain%60 == 0 || remain <= 10 {
+			m.broadcast(&info)
+		}
+	}
+}
+
+func (m *Maintenance) kick(info *proto.MaintenanceInfo) {
+	notify := &proto.PlazaKickNotify{
+		Code: proto.CODE_MAINTENANCE,
+		Msg:  info.Msg,
+	}
+
+	n := 0
+	for name := range userMgr.Clients() {
+		if acc, err := accountMgr.Get(name); err == nil && info.Allow(acc.Name, acc.Login) {
+			continue
+		}
+		userMgr.Kick(name, notify)
+		n++
+	}
+
+	log.Info("Maintenance kick %v users", n)
+}
@@ -0,0 +1,368 @@
+package app
+
+import (
+	"errors"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	matchMgr = &MatchMgr{
+		queues:    map[string][]*MatchEntry{},
+		users:     map[string]*MatchEntry{},
+		reserving: map[string]*MatchEntry{},
+	}
+
+	matchGameIdx uint64 = 0
+
+	ErrMatchInvalidKind = errors.New("invalid game kind")
+	ErrMatchQueued      = errors.New("already in queue")
+	ErrMatchNotQueued   = errors.New("not in queue")
+)
+
+// 匹配配置, 每种游戏类型一份
+type MatchConfig struct {
+	Size      int `json:"Size"`      // 每局人数
+	Window    int `json:"Window"`    // 初始匹配分差
+	Widen     int `json:"Widen"`     // 每等待一秒扩大的分差
+	MaxWindow int `json:"MaxWindow"` // 最大分差, 0 为不限制
+	Timeout   int `json:"Timeout"`   // 匹配超时, 单位秒
+}
+
+// 匹配分差窗口随等待时间扩大
+func (conf *MatchConfig) window(wait time.Duration) int {
+	window := conf.Window + conf.Widen*int(wait/time.Second)
+	if conf.MaxWindow > 0 && window > conf.MaxWindow {
+		window = conf.MaxWindow
+	}
+	return window
+}
+
+type MatchEntry struct {
+	Name     string
+	Kind     string
+	Rating   int
+	Enqueued time.Time
+
+	canceled bool // 预留房间过程中取消或下线
+}
+
+type MatchMgr struct {
+	sync.Mutex
+	queues    map[string][]*MatchEntry
+	users     map[string]*MatchEntry
+	reserving map[string]*MatchEntry // 已成组、正在预留房间的玩家
+}
+
+func (mgr *MatchMgr) Enqueue(name string, kind string, rating int) error {
+	if conf, ok := config.Match[kind]; !ok || conf.Size <= 0 {
+		return ErrMatchInvalidKind
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	if _, ok := mgr.users[name]; ok {
+		return ErrMatchQueued
+	}
+	if _, ok := mgr.reserving[name]; ok {
+		return ErrMatchQueued
+	}
+
+	entry := &MatchEntry{
+		Name:     name,
+		Kind:     kind,
+		Rating:   rating,
+		Enqueued: time.Now(),
+	}
+	mgr.users[name] = entry
+	mgr.queues[kind] = append(mgr.queues[kind], entry)
+
+	return nil
+}
+
+func (mgr *MatchMgr) Cancel(name string) error {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	// 正在预留房间时标记取消, 预留完成后该组不下发票据
+	if entry, ok := mgr.reserving[name]; ok {
+		entry.canceled = true
+		return nil
+	}
+
+	entry, ok := mgr.users[name]
+	if !ok {
+		return ErrMatchNotQueued
+	}
+	mgr.remove(entry)
+
+	return nil
+}
+
+// 预留结束, 返回组内是否有玩家取消
+func (mgr *MatchMgr) reserved(group []*MatchEntry) bool {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	canceled := false
+	for _, entry := range group {
+		delete(mgr.reserving, entry.Name)
+		canceled = canceled || entry.canceled
+	}
+	return canceled
+}
+
+// 用户下线时移出匹配队列
+func (mgr *MatchMgr) RemoveUser(name string) {
+	mgr.Cancel(name)
+}
+
+func (mgr *MatchMgr) remove(entry *MatchEntry) {
+	delete(mgr.users, entry.Name)
+
+	queue := mgr.queues[entry.Kind]
+	for i, e := range queue {
+		if e == entry {
+			mgr.queues[entry.Kind] = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+}
+
+// 预留房间失败或组内有玩家取消时将其余玩家放回队列, 保留原入队时间
+func (mgr *MatchMgr) requeue(group []*MatchEntry) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	for _, entry := range group {
+		if _, ok := mgr.users[entry.Name]; ok || entry.canceled {
+			continue
+		}
+		if _, online := userMgr.Get(entry.Name); !online {
+			continue
+		}
+		mgr.users[entry.Name] = entry
+		mgr.queues[entry.Kind] = append(mgr.queues[entry.Kind], entry)
+	}
+}
+
+func (mgr *MatchMgr) tick(now time.Time) {
+	var (
+		timeouts []*MatchEntry
+		groups   [][]*MatchEntry
+	)
+
+	mgr.Lock()
+	for kind, queue := range mgr.queues {
+		conf, ok := config.Match[kind]
+		if !ok {
+			continue
+		}
+
+		remain := queue[:0]
+		for _, entry := range queue {
+			if conf.Timeout > 0 && now.Sub(entry.Enqueued) >= time.Second*time.Duration(conf.Timeout) {
+				delete(mgr.users, entry.Name)
+				timeouts = append(timeouts, entry)
+			} else {
+				remain = append(remain, entry)
+			}
+		}
+		queue = remain
+
+		sort.Slice(queue, func(i, j int) bool {
+			return queue[i].Rating < queue[j].Rating
+		})
+
+		// 按分数排序后取相邻的 Size 个玩家, 分差不超过其中等待最久者的匹配窗口即成组
+		remain = nil
+		for i := 0; i < len(queue); {
+			if i+conf.Size > len(queue) {
+				remain = append(remain, queue[i:]...)
+				break
+			}
+
+			group := queue[i : i+conf.Size]
+			oldest := group[0].Enqueued
+			for _, entry := range group {
+				if entry.Enqueued.Before(oldest) {
+					oldest = entry.Enqueued
+				}
+			}
+
+			if group[len(group)-1].Rating-group[0].Rating <= conf.window(now.Sub(oldest)) {
+				for _, entry := range group {
+					delete(mgr.users, entry.Name)
+					mgr.reserving[entry.Name] = entry
+				}
+				groups = append(groups, append([]*MatchEntry{}, group...))
+				i += conf.Size
+			} else {
+				remain = append(remain, queue[i])
+				i++
+			}
+		}
+		mgr.queues[kind] = remain
+	}
+	mgr.Unlock()
+
+	for _, entry := range timeouts {
+		userMgr.SendTo(entry.Name, proto.NewMessage(proto.CMD_PLAZA_MATCH_NOTIFY, &proto.PlazaMatchNotify{
+			Code: proto.CODE_TIMEOUT,
+			Msg:  "match timeout",
+			Kind: entry.Kind,
+		}))
+	}
+
+	for _, group := range groups {
+		group := group
+		util.Go(func() {
+			mgr.reserve(group)
+		})
+	}
+}
+
+// 选择支持该游戏类型且房间内玩家最少的游戏服务器, 人数相同时轮流选择
+func pickGame(kind string) (string, *proto.GameInfo, bool) {
+	games := getGameList()
+	if len(games) == 0 {
+		return "", nil, false
+	}
+
+	ids := make([]string, 0, len(games))
+	for id := range games {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var (
+		pickId   string
+		pickInfo *proto.GameInfo
+		start    = int(atomic.AddUint64(&matchGameIdx, 1) % uint64(len(ids)))
+	)
+	for i := range ids {
+		id := ids[(start+i)%len(ids)]
+		info := &proto.GameInfo{}
+		if err := games[id].DecodeInfo(info); err != nil {
+			log.Error("pickGame %v DecodeInfo failed: %v", id, err)
+			continue
+		}
+		if !info.Supports(kind) {
+			continue
+		}
+		if pickInfo == nil || info.Players < pickInfo.Players {
+			pickId, pickInfo = id, info
+		}
+	}
+
+	return pickId, pickInfo, pickInfo != nil
+}
+
+// 获取游戏服务器信息
+func getGame(id string) (*proto.GameInfo, bool) {
+	svr, ok := getGameList()[id]
+	if !ok {
+		return nil, false
+	}
+	info := &proto.GameInfo{}
+	if err := svr.DecodeInfo(info); err != nil {
+		log.Error("getGame %v DecodeInfo failed: %v", id, err)
+		return nil, false
+	}
+	return info, true
+}
+
+// 经中心服务器申请观战票据, target 不为空时观战 target 所在的房间
+func reserveWatch(name string, gameId string, roomId string, target string) (string, error) {
+	var (
+		req = &proto.CenterReserveRoomReq{
+			Game:     gameId,
+			Players:  []string{name},
+			Spectate: true,
+			RoomId:   roomId,
+			Target:   target,
+		}
+		rsp = &proto.CenterReserveRoomRsp{}
+	)
+
+	err := centerSession.Call(proto.RPC_METHOD_RESERVE_ROOM, req, rsp, time.Second*3)
+	if err == nil && rsp.Code != 0 {
+		err = errors.New(rsp.Msg)
+	}
+	if err != nil {
+		return "", err
+	}
+	return rsp.Tickets[name], nil
+}
+
+// 在游戏服务器上预留房间并通知所有匹配到的玩家
+func (mgr *MatchMgr) reserve(group []*MatchEntry) {
+	kind := group[0].Kind
+	players := make([]string, len(group))
+	for i, entry := range group {
+		players[i] = entry.Name
+	}
+
+	gameId, info, ok := pickGame(kind)
+	if !ok {
+		log.Error("MatchMgr reserve %v failed: no game server", players)
+		mgr.reserved(group)
+		mgr.requeue(group)
+		return
+	}
+
+	var (
+		req = &proto.CenterReserveRoomReq{
+			Game:    gameId,
+			Kind:    kind,
+			Players: players,
+		}
+		rsp = &proto.CenterReserveRoomRsp{}
+	)
+
+	err := centerSession.Call(proto.RPC_METHOD_RESERVE_ROOM, req, rsp, time.Second*3)
+	if err == nil && rsp.Code != 0 {
+		err = errors.New(rsp.Msg)
+	}
+	if err != nil {
+		log.Error("MatchMgr reserve %v on %v failed: %v", players, gameId, err)
+		mgr.reserved(group)
+		mgr.requeue(group)
+		return
+	}
+
+	// 有玩家取消时不下发票据, 预留的房间到期无人加入后关闭
+	if mgr.reserved(group) {
+		log.Info("MatchMgr reserve %v on %v canceled, room: %v", players, gameId, rsp.RoomId)
+		mgr.requeue(group)
+		return
+	}
+
+	for _, name := range players {
+		userMgr.SendTo(name, proto.NewMessage(proto.CMD_PLAZA_MATCH_NOTIFY, &proto.PlazaMatchNotify{
+			Kind:    kind,
+			Game:    gameId,
+			Addr:    info.ClientAddr,
+			RoomId:  rsp.RoomId,
+			Ticket:  rsp.Tickets[name],
+			Players: players,
+		}))
+	}
+
+	log.Info("MatchMgr matched %v, kind: %v, game: %v, room: %v", players, kind, gameId, rsp.RoomId)
+}
+
+func (mgr *MatchMgr) run() {
+	util.Go(func() {
+		for {
+			time.Sleep(time.Second)
+			mgr.tick(time.Now())
+		}
+	})
+}
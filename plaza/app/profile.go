@@ -0,0 +1,305 @@
+package app
+
+import (
+	"errors"
+	"kisscluster/proto"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	bucketProfile  = "profile"  // 用户名 -> 玩家资料
+	bucketNickname = "nickname" // 昵称(小写) -> 用户名
+	bucketApplied  = "applied"  // 用户名:资产变更 ID -> 已处理标记
+
+	profileAppliedMax = 200
+)
+
+var (
+	profileMgr = &ProfileMgr{}
+
+	ErrInvalidNickname  = errors.New("invalid nickname")
+	ErrNicknameExist    = errors.New("nickname already used")
+	ErrInvalidAvatar    = errors.New("invalid avatar")
+	ErrSettingsTooLarge = errors.New("settings too large")
+	ErrProfileNotExist  = errors.New("profile not exist")
+)
+
+// 持久化的资料, Applied 记录最近已处理的资产变更 ID, 与资产一起保存;
+// 每个已处理的变更另有持久的标记, 超出最近记录的重复提交也只生效一次
+type profileRecord struct {
+	proto.Profile
+	Applied []string `json:"applied,omitempty"`
+}
+
+// 资产变更的已处理标记
+type appliedMark struct {
+	Time int64 `json:"time"`
+}
+
+type ProfileMgr struct {
+	sync.Mutex
+
+	nicknameMin int
+	nicknameMax int
+	avatarMax   int
+	settingsMax int
+	levelExp    []int64
+}
+
+func (mgr *ProfileMgr) init() {
+	mgr.nicknameMin = config.NicknameLenMin
+	if mgr.nicknameMin <= 0 {
+		mgr.nicknameMin = 2
+	}
+	mgr.nicknameMax = config.NicknameLenMax
+	if mgr.nicknameMax <= 0 {
+		mgr.nicknameMax = 16
+	}
+	mgr.avatarMax = config.AvatarMax
+	mgr.settingsMax = config.ProfileSettingsMax
+	if mgr.settingsMax <= 0 {
+		mgr.settingsMax = 4096
+	}
+	mgr.levelExp = config.LevelExp
+}
+
+func (mgr *ProfileMgr) load(name string) (*profileRecord, bool, error) {
+	record := &profileRecord{}
+	ok, err := store.Get(bucketProfile, name, record)
+	return record, ok, err
+}
+
+func (mgr *ProfileMgr) save(record *profileRecord) error {
+	return store.Put(bucketProfile, record.Name, record)
+}
+
+func (mgr *ProfileMgr) Get(name string) (*proto.Profile, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	record, ok, err := mgr.load(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrProfileNotExist
+	}
+	return &record.Profile, nil
+}
+
+// 登录时加载资料并更新登录时间, 资料不存在时以用户名为默认昵称创建
+func (mgr *ProfileMgr) Login(acc *Account) (*proto.Profile, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	record, ok, err := mgr.load(acc.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		record.Name = acc.Name
+		record.Level = 1
+		record.Created = acc.Created
+		if mgr.reserveNickname(acc.Name, acc.Name) == nil {
+			record.Nickname = acc.Name
+		}
+	}
+
+	record.LastLogin = time.Now().Unix()
+	return &record.Profile, mgr.save(record)
+}
+
+// 昵称长度与屏蔽词检查, 屏蔽词使用聊天过滤规则, 内容被过滤则视为不合法
+func (mgr *ProfileMgr) checkNickname(name string, nickname string) error {
+	if n := utf8.RuneCountInString(nickname); n < mgr.nicknameMin || n > mgr.nicknameMax {
+		return ErrInvalidNickname
+	}
+	if strings.TrimSpace(nickname) != nickname || strings.HasPrefix(nickname, guestPrefix) {
+		return ErrInvalidNickname
+	}
+	if filtered, ok := chatFilter(name, nickname); !ok || filtered != nickname {
+		return ErrInvalidNickname
+	}
+	return nil
+}
+
+// 原子地占用昵称, 多个大厅同时占用同一昵称时只有一个成功, 已被自己占用时直接返回
+func (mgr *ProfileMgr) reserveNickname(name string, nickname string) error {
+	key := strings.ToLower(nickname)
+
+	created, err := store.Create(bucketNickname, key, name)
+	if err != nil || created {
+		return err
+	}
+
+	var owner string
+	ok, err := store.Get(bucketNickname, key, &owner)
+	if err != nil {
+		return err
+	}
+	if !ok || owner != name {
+		return ErrNicknameExist
+	}
+	return nil
+}
+
+// 修改资料, 只修改 req 中不为空的字段
+func (mgr *ProfileMgr) Update(name string, req *proto.PlazaProfileUpdateReq) (*proto.Profile, error) {
+	if req.Nickname != nil {
+		if err := mgr.checkNickname(name, *req.Nickname); err != nil {
+			return nil, err
+		}
+	}
+	if req.Avatar != nil && (*req.Avatar < 0 || (mgr.avatarMax > 0 && *req.Avatar > mgr.avatarMax)) {
+		return nil, ErrInvalidAvatar
+	}
+	if req.Settings != nil && len(*req.Settings) > mgr.settingsMax {
+		return nil, ErrSettingsTooLarge
+	}
+
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	record, ok, err := mgr.load(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrProfileNotExist
+	}
+	profile := &record.Profile
+
+	var released, reserved string
+	if req.Nickname != nil && *req.Nickname != profile.Nickname {
+		if err = mgr.reserveNickname(name, *req.Nickname); err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(profile.Nickname, *req.Nickname) {
+			released, reserved = profile.Nickname, *req.Nickname
+		}
+		profile.Nickname = *req.Nickname
+	}
+	if req.Avatar != nil {
+		profile.Avatar = *req.Avatar
+	}
+	if req.Settings != nil {
+		profile.Settings = *req.Settings
+	}
+
+	// 资料保存成功后才释放旧昵称, 失败时释放新占用的昵称
+	if err = mgr.save(record); err != nil {
+		if reserved != "" {
+			store.Delete(bucketNickname, strings.ToLower(reserved))
+		}
+		return nil, err
+	}
+	if released != "" {
+		store.Delete(bucketNickname, strings.ToLower(released))
+	}
+	return profile, nil
+}
+
+// 升到下一级所需经验, 未配置时为 100*当前等级, 超出配置表时使用最后一项
+func (mgr *ProfileMgr) expToLevelUp(level int) int64 {
+	if len(mgr.levelExp) == 0 {
+		return int64(100 * level)
+	}
+	if level-1 < len(mgr.levelExp) {
+		return mgr.levelExp[level-1]
+	}
+	return mgr.levelExp[len(mgr.levelExp)-1]
+}
+
+// 增加经验并处理升级
+func (mgr *ProfileMgr) AddExp(name string, exp int64) (*proto.Profile, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	record, ok, err := mgr.load(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrProfileNotExist
+	}
+	profile := &record.Profile
+	mgr.addExp(profile, exp)
+
+	return profile, mgr.save(record)
+}
+
+func (mgr *ProfileMgr) addExp(profile *proto.Profile, exp int64) {
+	if profile.Level <= 0 {
+		profile.Level = 1
+	}
+	profile.Exp += exp
+	for need := mgr.expToLevelUp(profile.Level); need > 0 && profile.Exp >= need; need = mgr.expToLevelUp(profile.Level) {
+		profile.Exp -= need
+		profile.Level++
+	}
+}
+
+// 增加资产, id 为本次变更的唯一 ID, 已处理过的 id 不重复增加, 返回是否本次生效
+func (mgr *ProfileMgr) AddAssets(name string, id string, assets map[string]int64) (*proto.Profile, bool, error) {
+	return mgr.Apply(name, id, assets, 0)
+}
+
+// 增加资产和经验, 同 AddAssets 按 id 只生效一次
+func (mgr *ProfileMgr) Apply(name string, id string, assets map[string]int64, exp int64) (*proto.Profile, bool, error) {
+	mgr.Lock()
+	defer mgr.Unlock()
+
+	record, ok, err := mgr.load(name)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, ErrProfileNotExist
+	}
+	profile := &record.Profile
+
+	markKey := name + ":" + id
+	marked, err := store.Get(bucketApplied, markKey, &appliedMark{})
+	if err != nil {
+		return nil, false, err
+	}
+	if marked {
+		return profile, false, nil
+	}
+	// 资料已保存但标记未写入, 补写标记
+	if indexOf(record.Applied, id) >= 0 {
+		_, err = store.Create(bucketApplied, markKey, &appliedMark{Time: time.Now().Unix()})
+		return profile, false, err
+	}
+
+	if profile.Assets == nil {
+		profile.Assets = map[string]int64{}
+	}
+	for item, count := range assets {
+		profile.Assets[item] += count
+	}
+	if exp != 0 {
+		mgr.addExp(profile, exp)
+	}
+	record.Applied = append(record.Applied, id)
+	if len(record.Applied) > profileAppliedMax {
+		record.Applied = record.Applied[len(record.Applied)-profileAppliedMax:]
+	}
+
+	if err = mgr.save(record); err != nil {
+		return nil, false, err
+	}
+	_, err = store.Create(bucketApplied, markKey, &appliedMark{Time: time.Now().Unix()})
+	return profile, true, err
+}
+
+// 返回给其他玩家的资料, 不含设置数据
+func publicProfile(profile *proto.Profile) *proto.Profile {
+	public := *profile
+	public.Settings = ""
+	public.Assets = nil
+	return &public
+}
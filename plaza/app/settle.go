@@ -0,0 +1,85 @@
+package app
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"github.com/nothollyhigh/kiss/util"
+	"kisscluster/proto"
+	"time"
+)
+
+// 游戏服务器提交的结算, 按结算 ID 幂等地更新玩家资产和经验, 处理完成后经中心服务器确认;
+// 存储失败的玩家不确认, 由游戏服务器稍后重新提交
+func onSettleNotify(client *net.TcpClient, msg net.IMessage) {
+	var (
+		notify = &proto.CenterSettleNotify{}
+	)
+
+	err := proto.Unmarshal(msg.Body(), notify)
+	if err != nil || notify.Settlement == nil {
+		log.Error("onSettleNotify bind failed: %v", err)
+		return
+	}
+
+	util.Go(func() {
+		settle(notify.Settlement, notify.Names)
+	})
+}
+
+func settle(s *proto.Settlement, names []string) {
+	acked := []string{}
+	for _, name := range names {
+		result, ok := s.Players[name]
+		if !ok {
+			continue
+		}
+
+		profile, applied, err := profileMgr.Apply(name, "settle:"+s.Id, result.Assets, result.Exp)
+		if err == ErrProfileNotExist {
+			log.Warn("settle %v %v: profile not exist", s.Id, name)
+			acked = append(acked, name)
+			continue
+		}
+		if err != nil {
+			log.Error("settle %v %v failed: %v", s.Id, name, err)
+			continue
+		}
+		acked = append(acked, name)
+
+		if applied {
+			userMgr.SendTo(name, proto.NewMessage(proto.CMD_PLAZA_SETTLE_NOTIFY, &proto.PlazaSettleNotify{
+				Id:      s.Id,
+				Game:    s.Game,
+				RoomId:  s.RoomId,
+				Kind:    s.Kind,
+				Result:  result,
+				Profile: profile,
+			}))
+		}
+	}
+
+	if len(acked) == 0 {
+		return
+	}
+
+	var (
+		req = &proto.CenterSettleAckReq{
+			Game:  s.Game,
+			Id:    s.Id,
+			Names: acked,
+		}
+		rsp = &proto.CenterSettleAckRsp{}
+	)
+
+	err := centerSession.Call(proto.RPC_METHOD_SETTLE_ACK, req, rsp, time.Second*3)
+	if err != nil {
+		log.Error("settle %v ack failed: %v", s.Id, err)
+		return
+	}
+	if rsp.Code != 0 {
+		log.Error("settle %v ack failed, code: %v, msg: %v", s.Id, rsp.Code, rsp.Msg)
+		return
+	}
+
+	log.Info("settle %v from %v, names: %v", s.Id, s.Game, acked)
+}
@@ -0,0 +1,280 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/util"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	staticManifestPath   = "/manifest.json"
+	staticServerListPath = "/serverlist.json"
+)
+
+var (
+	staticServer = &StaticServer{}
+)
+
+// 热更新文件清单中的一项, Path 为相对 StaticDir 的 URL 路径
+type StaticFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+// 客户端热更新清单, Version 为全部文件哈希的摘要, 文件有变化时改变
+type StaticManifest struct {
+	Version          string        `json:"version"`
+	MinClientVersion string        `json:"minClientVersion"`
+	Files            []*StaticFile `json:"files"`
+}
+
+// 客户端启动时获取的服务器列表
+type StaticServerList struct {
+	Gates   []string `json:"gates"`
+	CdnBase string   `json:"cdnBase"`
+}
+
+// 文件哈希及计算哈希时的修改时间和大小, 文件变化后哈希失效
+type staticHash struct {
+	hash    string
+	modTime time.Time
+	size    int64
+}
+
+func (h *staticHash) valid(info os.FileInfo) bool {
+	return h != nil && h.modTime.Equal(info.ModTime()) && h.size == info.Size()
+}
+
+type staticContent struct {
+	data []byte
+	etag string
+}
+
+func newStaticContent(v interface{}) *staticContent {
+	data, _ := json.Marshal(v)
+	sum := md5.Sum(data)
+	return &staticContent{
+		data: data,
+		etag: `"` + hex.EncodeToString(sum[:]) + `"`,
+	}
+}
+
+// 在 StaticAddr 上提供客户端热更新资源、版本清单和服务器列表
+type StaticServer struct {
+	sync.RWMutex
+
+	server *http.Server
+
+	dir        string
+	hashes     map[string]*staticHash
+	manifest   *staticContent
+	serverList *staticContent
+}
+
+func (ss *StaticServer) start() {
+	if config.StaticAddr == "" {
+		return
+	}
+
+	ss.dir = config.StaticDir
+	if ss.dir == "" {
+		ss.dir = "./static/"
+	}
+
+	ss.serverList = newStaticContent(&StaticServerList{
+		Gates:   config.GateAddrs,
+		CdnBase: config.CdnBase,
+	})
+	ss.refresh()
+
+	interval := time.Second * time.Duration(config.ManifestRefresh)
+	if interval <= 0 {
+		interval = time.Second * 60
+	}
+	util.Go(func() {
+		for {
+			time.Sleep(interval)
+			ss.refresh()
+		}
+	})
+
+	ss.server = &http.Server{
+		Addr:    config.StaticAddr,
+		Handler: ss,
+	}
+	util.Go(func() {
+		log.Info("StaticServer start on %v, dir: %v", config.StaticAddr, ss.dir)
+		if err := ss.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Error("StaticServer ListenAndServe failed: %v", err)
+		}
+	})
+}
+
+func (ss *StaticServer) stop() {
+	if ss.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	ss.server.Shutdown(ctx)
+}
+
+func hashFile(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return hashReader(file)
+}
+
+func hashReader(r io.Reader) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 重新扫描 StaticDir 生成清单
+func (ss *StaticServer) refresh() {
+	var (
+		files  = []*StaticFile{}
+		hashes = map[string]*staticHash{}
+		digest = md5.New()
+	)
+
+	err := filepath.Walk(ss.dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(ss.dir, filename)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(filename)
+		if err != nil {
+			return err
+		}
+		urlPath := "/" + filepath.ToSlash(rel)
+		hashes[urlPath] = &staticHash{hash: hash, modTime: info.ModTime(), size: info.Size()}
+		files = append(files, &StaticFile{
+			Path: urlPath,
+			Size: info.Size(),
+			Hash: hash,
+		})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		log.Error("StaticServer refresh failed: %v", err)
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	for _, f := range files {
+		fmt.Fprintf(digest, "%v:%v\n", f.Path, f.Hash)
+	}
+
+	manifest := newStaticContent(&StaticManifest{
+		Version:          hex.EncodeToString(digest.Sum(nil)),
+		MinClientVersion: config.MinClientVersion,
+		Files:            files,
+	})
+
+	ss.Lock()
+	ss.hashes = hashes
+	ss.manifest = manifest
+	ss.Unlock()
+}
+
+func (ss *StaticServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := path.Clean("/" + r.URL.Path)
+
+	ss.RLock()
+	manifest, serverList, hash := ss.manifest, ss.serverList, ss.hashes[urlPath]
+	ss.RUnlock()
+
+	switch urlPath {
+	case staticManifestPath:
+		ss.serveContent(w, r, "manifest.json", manifest)
+		return
+	case staticServerListPath:
+		ss.serveContent(w, r, "serverlist.json", serverList)
+		return
+	}
+
+	filename := filepath.Join(ss.dir, filepath.FromSlash(strings.TrimPrefix(urlPath, "/")))
+	file, err := os.Open(filename)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	// 清单中的文件使用内容哈希作为 ETag, 文件在两次刷新之间变化时按实际下发的内容重新计算,
+	// 不在清单中的文件由 ServeContent 按修改时间处理缓存
+	if hash != nil {
+		if !hash.valid(info) {
+			if hash, err = ss.rehash(urlPath, file, info); err != nil {
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("ETag", `"`+hash.hash+`"`)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// 重新计算已打开文件的哈希并更新缓存, 计算后回到文件开头
+func (ss *StaticServer) rehash(urlPath string, file *os.File, info os.FileInfo) (*staticHash, error) {
+	sum, err := hashReader(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	hash := &staticHash{hash: sum, modTime: info.ModTime(), size: info.Size()}
+	ss.Lock()
+	if ss.hashes[urlPath] != nil {
+		ss.hashes[urlPath] = hash
+	}
+	ss.Unlock()
+
+	return hash, nil
+}
+
+func (ss *StaticServer) serveContent(w http.ResponseWriter, r *http.Request, name string, content *staticContent) {
+	w.Header().Set("ETag", content.etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content.data))
+}
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"errors"
+	"github.com/nothollyhigh/kiss/log"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	store Store
+
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// 存储接口, 按 bucket/key 存取序列化后的数据, 多个大厅部署时应共享同一存储
+type Store interface {
+	// 读取 key 到 v, key 不存在时返回 false
+	Get(bucket string, key string, v interface{}) (bool, error)
+	Put(bucket string, key string, v interface{}) error
+	// 仅在 key 不存在时写入, 已存在时返回 false, 多个大厅共享存储时用于原子地占用 key
+	Create(bucket string, key string, v interface{}) (bool, error)
+	Delete(bucket string, key string) error
+	Keys(bucket string) ([]string, error)
+}
+
+// 设置存储实现, 应在 Run 之前调用, 未设置时使用 DataDir 下的本地文件存储
+func SetStore(s Store) {
+	store = s
+}
+
+// 本地文件存储, 每个 key 一个文件: DataDir/bucket/key.json
+type FileStore struct {
+	sync.RWMutex
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (fs *FileStore) path(bucket string, key string) (string, error) {
+	if bucket == "" || key == "" {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(fs.dir, url.PathEscape(bucket), url.PathEscape(key)+".json"), nil
+}
+
+func (fs *FileStore) Get(bucket string, key string, v interface{}) (bool, error) {
+	path, err := fs.path(bucket, key)
+	if err != nil {
+		return false, err
+	}
+
+	fs.RLock()
+	data, err := ioutil.ReadFile(path)
+	fs.RUnlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, v)
+}
+
+func (fs *FileStore) Put(bucket string, key string, v interface{}) error {
+	path, err := fs.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// 先写临时文件再改名, 避免进程崩溃时留下不完整的数据
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// 先写临时文件再硬链接到目标路径, 目标已存在时链接失败, 共享目录的多个进程之间也是原子的
+func (fs *FileStore) Create(bucket string, key string, v interface{}) (bool, error) {
+	path, err := fs.path(bucket, key)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false, err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".create-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err = os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (fs *FileStore) Delete(bucket string, key string) error {
+	path, err := fs.path(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	fs.Lock()
+	defer fs.Unlock()
+
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStore) Keys(bucket string) ([]string, error) {
+	fs.RLock()
+	files, err := ioutil.ReadDir(filepath.Join(fs.dir, url.PathEscape(bucket)))
+	fs.RUnlock()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if key, err := url.PathUnescape(strings.TrimSuffix(name, ".json")); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func initStore() {
+	if store != nil {
+		return
+	}
+
+	dir := config.DataDir
+	if dir == "" {
+		dir = "./data/plaza/"
+	}
+
+	fs, err := NewFileStore(dir)
+	if err != nil {
+		log.Panic("initStore failed: %v", err)
+	}
+	store = fs
+}
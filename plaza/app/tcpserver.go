@@ -5,16 +5,50 @@ import (
 	"github.com/nothollyhigh/kiss/net"
 	"github.com/nothollyhigh/kiss/util"
 	"kisscluster/proto"
+	"kisscluster/session"
 	"os"
 	"time"
 )
 
 var (
 	tcpServer = net.NewTcpServer("Plaza")
+	router    = session.NewRouter(tcpServer)
 )
 
 func startTcpServer() {
-	tcpServer.Handle(proto.CMD_PLAZA_LOGIN_REQ, onPlazaLoginReq)
+	if config.AuthKickThreshold > 0 {
+		router.KickThreshold = config.AuthKickThreshold
+	}
+	if err := router.HandleRealIp(config.TrustedGates); err != nil {
+		log.Panic("startTcpServer TrustedGates invalid: %v", err)
+	}
+
+	router.HandlePublic(proto.CMD_PLAZA_LOGIN_REQ, onPlazaLoginReq)
+	router.HandleAuth(proto.CMD_PLAZA_ACCOUNT_BIND_REQ, onPlazaAccountBindReq)
+	router.HandleAuth(proto.CMD_PLAZA_CHAT_JOIN_REQ, onPlazaChatJoinReq)
+	router.HandleAuth(proto.CMD_PLAZA_CHAT_LEAVE_REQ, onPlazaChatLeaveReq)
+	router.HandleAuth(proto.CMD_PLAZA_CHAT_SEND_REQ, onPlazaChatSendReq)
+	router.HandleAuth(proto.CMD_PLAZA_USER_LOOKUP_REQ, onPlazaUserLookupReq)
+	router.HandleAuth(proto.CMD_PLAZA_FRIEND_LIST_REQ, onPlazaFriendListReq)
+	router.HandleAuth(proto.CMD_PLAZA_FRIEND_ADD_REQ, onPlazaFriendAddReq)
+	router.HandleAuth(proto.CMD_PLAZA_FRIEND_ACCEPT_REQ, onPlazaFriendAcceptReq)
+	router.HandleAuth(proto.CMD_PLAZA_FRIEND_REJECT_REQ, onPlazaFriendRejectReq)
+	router.HandleAuth(proto.CMD_PLAZA_FRIEND_REMOVE_REQ, onPlazaFriendRemoveReq)
+	router.HandleAuth(proto.CMD_PLAZA_MATCH_REQ, onPlazaMatchReq)
+	router.HandleAuth(proto.CMD_PLAZA_MATCH_CANCEL_REQ, onPlazaMatchCancelReq)
+	router.HandleAuth(proto.CMD_PLAZA_WATCH_REQ, onPlazaWatchReq)
+	router.HandleAuth(proto.CMD_PLAZA_PROFILE_GET_REQ, onPlazaProfileGetReq)
+	router.HandleAuth(proto.CMD_PLAZA_PROFILE_UPDATE_REQ, onPlazaProfileUpdateReq)
+	router.HandleAuth(proto.CMD_PLAZA_MAIL_LIST_REQ, onPlazaMailListReq)
+	router.HandleAuth(proto.CMD_PLAZA_MAIL_READ_REQ, onPlazaMailReadReq)
+	router.HandleAuth(proto.CMD_PLAZA_MAIL_CLAIM_REQ, onPlazaMailClaimReq)
+	router.HandleAuth(proto.CMD_PLAZA_MAIL_DELETE_REQ, onPlazaMailDeleteReq)
+
+	router.HandleRole(proto.CMD_PLAZA_ADMIN_BAN_ADD_REQ, session.ROLE_ADMIN, onPlazaAdminBanAddReq)
+	router.HandleRole(proto.CMD_PLAZA_ADMIN_BAN_LIST_REQ, session.ROLE_ADMIN, onPlazaAdminBanListReq)
+	router.HandleRole(proto.CMD_PLAZA_ADMIN_BAN_LIFT_REQ, session.ROLE_ADMIN, onPlazaAdminBanLiftReq)
+	router.HandleRole(proto.CMD_PLAZA_ADMIN_MAINTENANCE_REQ, session.ROLE_ADMIN, onPlazaAdminMaintenanceReq)
+	router.HandleRole(proto.CMD_PLAZA_ADMIN_MAIL_SEND_REQ, session.ROLE_ADMIN, onPlazaAdminMailSendReq)
 
 	util.Go(func() {
 		tcpServer.Start(config.SvrAddr)
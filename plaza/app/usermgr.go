@@ -10,37 +10,130 @@ import (
 var (
 	userMgr = &UserMgr{
 		users: map[string]*net.TcpClient{},
+		names: map[*net.TcpClient]string{},
 	}
 )
 
 type UserMgr struct {
 	sync.RWMutex
 	users map[string]*net.TcpClient
+	names map[*net.TcpClient]string
 }
 
+// 添加在线用户, 同一用户重复登录时踢掉旧连接
 func (mgr *UserMgr) Add(name string, client *net.TcpClient) {
 	mgr.Lock()
 	defer mgr.Unlock()
 
+	if old, ok := mgr.users[name]; ok && old != client {
+		delete(mgr.names, old)
+		old.Stop()
+		log.Info("UserMgr Add %v, kick previous client", name)
+	}
+
 	mgr.users[name] = client
+	mgr.names[client] = name
 }
 
-func (mgr *UserMgr) Delete(name string) {
+// 删除在线用户, 仅当 client 仍是该用户的当前连接时删除并返回 true
+func (mgr *UserMgr) Delete(name string, client *net.TcpClient) bool {
 	mgr.Lock()
 	defer mgr.Unlock()
 
+	if cur, ok := mgr.users[name]; !ok || cur != client {
+		return false
+	}
+
+	delete(mgr.names, client)
 	delete(mgr.users, name)
+
+	return true
+}
+
+func (mgr *UserMgr) Get(name string) (*net.TcpClient, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	client, ok := mgr.users[name]
+	return client, ok
+}
+
+func (mgr *UserMgr) Count() int {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	return len(mgr.users)
+}
+
+func (mgr *UserMgr) Names() []string {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	names := make([]string, 0, len(mgr.users))
+	for name := range mgr.users {
+		names = append(names, name)
+	}
+	return names
+}
+
+// 根据连接获取已登录的用户名
+func (mgr *UserMgr) GetName(client *net.TcpClient) (string, bool) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	name, ok := mgr.names[client]
+	return name, ok
+}
+
+// 发送消息给本大厅的在线用户, 用户不在线返回 false
+func (mgr *UserMgr) SendTo(name string, msg net.IMessage) bool {
+	client, ok := mgr.Get(name)
+	if ok {
+		client.SendMsg(msg)
+	}
+	return ok
+}
+
+func (mgr *UserMgr) Broadcast(msg net.IMessage) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	for _, client := range mgr.users {
+		client.SendMsg(msg)
+	}
 }
 
 func (mgr *UserMgr) KickClient(client *net.TcpClient, err error) {
 	client.Stop()
 }
 
+// 发送踢下线通知后断开用户连接
+func (mgr *UserMgr) Kick(name string, notify *proto.PlazaKickNotify) bool {
+	client, ok := mgr.Get(name)
+	if ok {
+		client.SendMsgWithCallback(proto.NewMessage(proto.CMD_PLAZA_KICK_NOTIFY, notify), mgr.KickClient)
+		log.Info("UserMgr Kick %v: %v", name, notify.Msg)
+	}
+	return ok
+}
+
+// 在线用户快照
+func (mgr *UserMgr) Clients() map[string]*net.TcpClient {
+	mgr.RLock()
+	defer mgr.RUnlock()
+
+	clients := make(map[string]*net.TcpClient, len(mgr.users))
+	for name, client := range mgr.users {
+		clients[name] = client
+	}
+	return clients
+}
+
 func (mgr *UserMgr) BroadcastGameList() {
 	mgr.RLock()
 	defer mgr.RUnlock()
 
-	msg := proto.NewMessage(proto.CMD_PLAZA_GAME_LIST_NOTIFY, gameList)
+	msg := proto.NewMessage(proto.CMD_PLAZA_GAME_LIST_NOTIFY, getGameList())
 
 	for _, client := range mgr.users {
 		client.SendMsg(msg)
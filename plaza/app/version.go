@@ -0,0 +1,64 @@
+package app
+
+import (
+	"kisscluster/proto"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPlatform = "default"
+)
+
+// 每个平台的客户端版本要求
+type ClientVersionConfig struct {
+	Min         string `json:"Min"`         // 低于此版本必须更新
+	Recommended string `json:"Recommended"` // 低于此版本建议更新
+	Url         string `json:"Url"`         // 下载地址
+}
+
+// 客户端版本检查结果
+type ClientUpdate struct {
+	Update int
+	Url    string
+}
+
+// 按点分段比较版本号, 每段按数字比较, 缺失的段视为 0
+func compareVersion(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(strings.TrimSpace(as[i]))
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(strings.TrimSpace(bs[i]))
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// 按平台检查客户端版本, 未配置的平台使用 default 配置, 未上报版本的旧客户端视为最低版本
+func checkClientVersion(platform, version string) *ClientUpdate {
+	cfg, ok := config.ClientVersions[platform]
+	if !ok {
+		cfg = config.ClientVersions[defaultPlatform]
+	}
+	if cfg == nil {
+		return &ClientUpdate{Update: proto.UPDATE_NONE}
+	}
+
+	switch {
+	case cfg.Min != "" && compareVersion(version, cfg.Min) < 0:
+		return &ClientUpdate{Update: proto.UPDATE_FORCE, Url: cfg.Url}
+	case cfg.Recommended != "" && compareVersion(version, cfg.Recommended) < 0:
+		return &ClientUpdate{Update: proto.UPDATE_SUGGEST, Url: cfg.Url}
+	}
+	return &ClientUpdate{Update: proto.UPDATE_NONE}
+}
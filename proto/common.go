@@ -1,5 +1,17 @@
 package proto
 
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	CMD_ERROR_NOTIFY uint32 = 900 // 通用错误通知, 请求被拒绝且没有对应的响应时下发
+)
+
 var (
 	SERVER_TYPE_PLAZA = "plaza"
 	SERVER_TYPE_GAME  = "game"
@@ -10,3 +22,194 @@ type ServerInfo struct {
 	Type string
 	Info interface{}
 }
+
+// 通用返回码, 0 为成功
+const (
+	CODE_OK           = 0
+	CODE_ERROR        = -1 // 通用错误
+	CODE_USER_OFFLINE = -2 // 用户不在线
+	CODE_TIMEOUT      = -3 // 超时
+	CODE_SERVER_FULL  = -4 // 服务器已满
+	CODE_UNAUTHORIZED = -5 // 未登录或权限不足
+	CODE_BANNED       = -6 // 账号或 IP 被封禁
+	CODE_MAINTENANCE  = -7 // 停服维护中
+	CODE_FORCE_UPDATE = -8 // 客户端版本过低, 必须更新
+	CODE_ACCOUNT_USED = -9 // 账号已被其他用户使用
+
+	CODE_LOGIN_QUEUED = 1 // 登录排队中, 轮到时再次下发登录响应
+)
+
+type ErrorNotify struct {
+	Cmd  uint32 `json:"cmd"`
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// 封禁类型
+const (
+	BAN_TYPE_ACCOUNT = "account" // 按用户名封禁
+	BAN_TYPE_IP      = "ip"      // 按 IP 或 CIDR 封禁
+)
+
+// 封禁记录, Expire 为 0 时永久封禁
+type BanInfo struct {
+	Id       string `json:"id"`
+	Type     string `json:"type"`
+	Target   string `json:"target"`
+	Reason   string `json:"reason"`
+	Expire   int64  `json:"expire"`
+	Created  int64  `json:"created"`
+	Operator string `json:"operator"`
+}
+
+// 停服维护状态, EndTime 为计划结束时间(Unix 秒), 到期自动退出维护, 0 为不自动退出
+// KickDelay 大于 0 时, 倒计时 KickDelay 秒后踢掉不在白名单中的在线用户
+type MaintenanceInfo struct {
+	Enabled   bool     `json:"enabled"`
+	Msg       string   `json:"msg"`
+	EndTime   int64    `json:"endTime"`
+	Whitelist []string `json:"whitelist,omitempty"`
+	KickDelay int      `json:"kickDelay,omitempty"`
+	KickAt    int64    `json:"kickAt,omitempty"` // 踢人时间, 由中心服务器按 KickDelay 计算, 重发时不变
+}
+
+// 是否处于维护中
+func (info *MaintenanceInfo) Active(now int64) bool {
+	return info != nil && info.Enabled && (info.EndTime == 0 || now < info.EndTime)
+}
+
+// 用户名或登录账号是否在维护白名单中
+func (info *MaintenanceInfo) Allow(names ...string) bool {
+	for _, w := range info.Whitelist {
+		for _, name := range names {
+			if name != "" && name == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 一局的结算, Id 全局唯一, 大厅按 Id 幂等处理, 重复提交只生效一次
+type Settlement struct {
+	Id      string                       `json:"id"`
+	Game    string                       `json:"game"`
+	RoomId  string                       `json:"roomId"`
+	Kind    string                       `json:"kind"`
+	Start   int64                        `json:"start"`
+	End     int64                        `json:"end"`
+	Players map[string]*SettlementResult `json:"players"`
+	Replay  string                       `json:"replay,omitempty"` // 录像 ID, 未录像时为空
+	Fair    *FairSeed                    `json:"fair,omitempty"`   // 本局的随机数种子, 用于事后校验
+}
+
+var (
+	ErrFairCommitment = errors.New("server seed does not match commitment")
+	ErrFairSeed       = errors.New("seed does not match server seed and public seed")
+	ErrFairPublicSeed = errors.New("public seed does not match client seeds")
+)
+
+// 可校验的随机数种子: 一局开始前(房间创建或上一局结束时)公布 ServerSeed 的 sha256 哈希 Commitment,
+// 玩家准备时提交客户端种子, 开局时公布按座位顺序的 ClientSeeds 和由其计算的公开种子 PublicSeed,
+// 一局结束后公布 ServerSeed, 房间随机数种子 Seed 由 ServerSeed 和 PublicSeed 计算得到
+type FairSeed struct {
+	Commitment  string   `json:"commitment"`
+	ClientSeeds []string `json:"clientSeeds,omitempty"` // 开局前为空, 空座位和机器人为空字符串
+	PublicSeed  string   `json:"publicSeed,omitempty"`  // 开局前为空
+	ServerSeed  string   `json:"serverSeed,omitempty"`  // 公布前为空
+	Seed        int64    `json:"seed,omitempty"`        // 公布前为空
+}
+
+func FairCommitment(serverSeed string) string {
+	sum := sha256.Sum256([]byte(serverSeed))
+	return hex.EncodeToString(sum[:])
+}
+
+// 公开种子为 sha256(每个客户端种子写为 "长度:内容" 后依次拼接), 十六进制
+func FairPublicSeed(clientSeeds []string) string {
+	h := sha256.New()
+	for _, seed := range clientSeeds {
+		fmt.Fprintf(h, "%d:%s", len(seed), seed)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 随机数种子为 sha256(ServerSeed + ":" + PublicSeed) 的前 8 字节, 大端
+func FairSeedValue(serverSeed string, publicSeed string) int64 {
+	sum := sha256.Sum256([]byte(serverSeed + ":" + publicSeed))
+	return int64(binary.BigEndian.Uint64(sum[:8]))
+}
+
+// 校验公布的 ServerSeed 与承诺一致, PublicSeed 由 ClientSeeds 计算得到, 且 Seed 由 ServerSeed 和 PublicSeed 计算得到
+func (f *FairSeed) Verify() error {
+	if FairCommitment(f.ServerSeed) != f.Commitment {
+		return ErrFairCommitment
+	}
+	if FairPublicSeed(f.ClientSeeds) != f.PublicSeed {
+		return ErrFairPublicSeed
+	}
+	if FairSeedValue(f.ServerSeed, f.PublicSeed) != f.Seed {
+		return ErrFairSeed
+	}
+	return nil
+}
+
+// 不包含 ServerSeed 和 Seed, 开局前只有 Commitment
+func (f *FairSeed) Committed() *FairSeed {
+	return &FairSeed{
+		Commitment:  f.Commitment,
+		ClientSeeds: f.ClientSeeds,
+		PublicSeed:  f.PublicSeed,
+	}
+}
+
+// 玩家的结算结果, Rank 从 1 开始, Assets 为道具/货币变化量, 可为负数
+type SettlementResult struct {
+	Rank   int              `json:"rank"`
+	Win    bool             `json:"win"`
+	Exp    int64            `json:"exp,omitempty"`
+	Assets map[string]int64 `json:"assets,omitempty"`
+}
+
+// 用户在集群中的位置, Game 为空表示不在游戏中
+type UserLocation struct {
+	Name  string `json:"name"`
+	Plaza string `json:"plaza"`
+	Game  string `json:"game"`
+}
+
+// 游戏服务器信息, 注册到中心服务器时作为 ServerInfo.Info 上报
+type GameInfo struct {
+	Addr       string   `json:"addr"`
+	ClientAddr string   `json:"clientAddr"` // 客户端连接地址, 一般为网关地址
+	Rooms      int      `json:"rooms"`      // 房间数
+	Players    int      `json:"players"`    // 房间内玩家数
+	Spectators int      `json:"spectators"` // 观战人数
+	Kinds      []string `json:"kinds"`      // 支持的游戏类型
+
+	TickOverruns int   `json:"tickOverruns"` // 上报周期内房间帧超时次数
+	TickDropped  int64 `json:"tickDropped"`  // 上报周期内房间落后太多丢弃的帧数
+	TickMaxCost  int   `json:"tickMaxCost"`  // 上报周期内最长帧耗时, 单位毫秒
+}
+
+// 是否支持该游戏类型, 未上报类型的旧版本游戏服务器视为支持所有类型
+func (info *GameInfo) Supports(kind string) bool {
+	if len(info.Kinds) == 0 {
+		return true
+	}
+	for _, k := range info.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析 Info 到 v, 经中心服务器转发后 Info 为通用的 map 结构
+func (info *ServerInfo) DecodeInfo(v interface{}) error {
+	data, err := Marshal(info.Info)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, v)
+}
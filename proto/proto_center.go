@@ -2,8 +2,29 @@ package proto
 
 const (
 	RPC_METHOD_UPDATE_SERVER_INFO = "update server info"
+	RPC_METHOD_CHAT_RELAY         = "chat relay"
+	RPC_METHOD_USER_ONLINE        = "user online"
+	RPC_METHOD_USER_OFFLINE       = "user offline"
+	RPC_METHOD_USER_SYNC          = "user sync"
+	RPC_METHOD_USER_UPDATE_GAME   = "user update game"
+	RPC_METHOD_USER_LOOKUP        = "user lookup"
+	RPC_METHOD_USER_DELIVER       = "user deliver"
+	RPC_METHOD_RESERVE_ROOM       = "reserve room"
+	RPC_METHOD_BAN_SYNC           = "ban sync"
+	RPC_METHOD_BAN_LIST           = "ban list"
+	RPC_METHOD_SET_MAINTENANCE    = "set maintenance"
+	RPC_METHOD_SETTLE             = "settle"
+	RPC_METHOD_SETTLE_ACK         = "settle ack"
 
 	CMD_CENTER_UPDATE_GAME_LIST_NOTIFY uint32 = 1
+	CMD_CENTER_CHAT_NOTIFY             uint32 = 2
+	CMD_CENTER_USER_DELIVER_NOTIFY     uint32 = 3
+	CMD_CENTER_USER_STATUS_NOTIFY      uint32 = 4 // 用户进入/离开游戏, 通知用户所在大厅, body 为 UserLocation
+	CMD_CENTER_RESERVE_ROOM_NOTIFY     uint32 = 5 // 通知游戏服务器预留房间
+	CMD_CENTER_BAN_NOTIFY              uint32 = 6 // 同步封禁变化到其他大厅, body 为 CenterBanSyncReq
+	CMD_CENTER_MAINTENANCE_NOTIFY      uint32 = 7 // 同步停服维护状态到所有大厅, body 为 MaintenanceInfo
+	CMD_CENTER_SETTLE_NOTIFY           uint32 = 8 // 结算转发到玩家所在大厅, body 为 CenterSettleNotify
+	CMD_CENTER_SETTLE_ACK_NOTIFY       uint32 = 9 // 大厅处理完结算后通知游戏服务器, body 为 CenterSettleAckReq
 )
 
 type CenterUpdateServerInfoReq struct {
@@ -14,3 +35,180 @@ type CenterUpdateServerInfoRsp struct {
 	Code int
 	Msg  string
 }
+
+// 大厅转发频道聊天消息到其他大厅
+type CenterChatRelayReq struct {
+	Plaza string
+	Chat  *ChatMsg
+}
+
+type CenterChatRelayRsp struct {
+	Code int
+	Msg  string
+}
+
+// 大厅登记在线用户
+type CenterUserOnlineReq struct {
+	Plaza string
+	Name  string
+}
+
+type CenterUserOnlineRsp struct {
+	Code int
+	Msg  string
+}
+
+type CenterUserOfflineReq struct {
+	Plaza string
+	Name  string
+}
+
+type CenterUserOfflineRsp struct {
+	Code int
+	Msg  string
+}
+
+// 大厅重连中心服务器后同步全部在线用户
+type CenterUserSyncReq struct {
+	Plaza string
+	Names []string
+}
+
+type CenterUserSyncRsp struct {
+	Code int
+	Msg  string
+}
+
+// 更新用户所在游戏服务器, Game 为空表示离开游戏
+type CenterUserUpdateGameReq struct {
+	Name string
+	Game string
+}
+
+type CenterUserUpdateGameRsp struct {
+	Code int
+	Msg  string
+}
+
+type CenterUserLookupReq struct {
+	Names []string
+}
+
+// Users 中不存在的用户为离线
+type CenterUserLookupRsp struct {
+	Code  int
+	Msg   string
+	Users map[string]*UserLocation
+}
+
+// 投递消息给任意大厅上的在线用户, 用户离线返回 CODE_USER_OFFLINE
+type CenterUserDeliverReq struct {
+	To   string
+	Cmd  uint32
+	Body []byte
+}
+
+type CenterUserDeliverRsp struct {
+	Code int
+	Msg  string
+}
+
+type CenterUserDeliverNotify struct {
+	To   string
+	Cmd  uint32
+	Body []byte
+}
+
+// 大厅匹配成功后在指定游戏服务器上预留房间, 中心服务器生成房间ID和每个玩家的入场票据
+// Spectate 为 true 时为 Players 生成观战票据, 观战的房间为 RoomId 或 Target 所在的房间
+type CenterReserveRoomReq struct {
+	Game     string
+	Kind     string
+	Players  []string
+	Spectate bool
+	RoomId   string
+	Target   string
+}
+
+type CenterReserveRoomRsp struct {
+	Code    int
+	Msg     string
+	RoomId  string
+	Tickets map[string]string // 玩家 -> 票据
+}
+
+type CenterReserveRoomNotify struct {
+	RoomId   string
+	Kind     string
+	Players  []string
+	Tickets  map[string]string
+	Expire   int64
+	Spectate bool
+	Target   string
+}
+
+// 大厅添加或解除封禁后同步到其他大厅, Lift 为 true 时解除封禁
+type CenterBanSyncReq struct {
+	Plaza string
+	Ban   *BanInfo
+	Lift  bool
+}
+
+type CenterBanSyncRsp struct {
+	Code int
+	Msg  string
+}
+
+// 封禁解除记录的保留时间(秒), 大厅与中心服务器断开超过该时间时, 期间解除的封禁不再补齐
+const BAN_LIFTED_KEEP = 24 * 3600
+
+// 大厅连接中心服务器后上报本地的封禁和解除记录, 中心服务器合并后返回全部封禁和已解除的封禁 ID
+type CenterBanListReq struct {
+	Plaza  string
+	Bans   []*BanInfo
+	Lifted []string
+}
+
+type CenterBanListRsp struct {
+	Code   int
+	Msg    string
+	Bans   []*BanInfo
+	Lifted []string
+}
+
+type CenterSetMaintenanceReq struct {
+	MaintenanceInfo
+}
+
+type CenterSetMaintenanceRsp struct {
+	Code int
+	Msg  string
+}
+
+// 游戏服务器提交结算, 中心服务器按玩家所在大厅拆分转发, 离线玩家转发到任意大厅
+type CenterSettleReq struct {
+	Settlement *Settlement
+}
+
+type CenterSettleRsp struct {
+	Code int
+	Msg  string
+}
+
+// Names 为由该大厅处理的玩家
+type CenterSettleNotify struct {
+	Settlement *Settlement
+	Names      []string
+}
+
+// 大厅处理完结算后确认, 由中心服务器转发给提交结算的游戏服务器
+type CenterSettleAckReq struct {
+	Game  string
+	Id    string
+	Names []string
+}
+
+type CenterSettleAckRsp struct {
+	Code int
+	Msg  string
+}
@@ -0,0 +1,29 @@
+package proto
+
+// 示例游戏: 掷骰子, 所有玩家掷出后公布点数, 点数最大的玩家获胜
+// 经 CMD_GAME_LOGIC_REQ/CMD_GAME_LOGIC_NOTIFY 收发
+
+const (
+	GAME_KIND_DICE = "dice"
+
+	DICE_ACTION_ROLL = "roll"
+
+	DICE_NOTIFY_START    = "start"    // 开始, 下发掷骰截止时间
+	DICE_NOTIFY_ROLLED   = "rolled"   // 有玩家掷出, Point 只下发给本人
+	DICE_NOTIFY_RESULT   = "result"   // 全部掷出或超时, 公布所有点数和赢家
+	DICE_NOTIFY_SNAPSHOT = "snapshot" // 掉线重连或观战时下发当前局面, Point 为本人点数(观战时为空), Rolled 为已掷出的玩家
+)
+
+type DiceReq struct {
+	Action string `json:"action"`
+}
+
+type DiceNotify struct {
+	Type     string         `json:"type"`
+	Name     string         `json:"name,omitempty"`
+	Point    int            `json:"point,omitempty"`
+	Deadline int64          `json:"deadline,omitempty"`
+	Points   map[string]int `json:"points,omitempty"`
+	Winners  []string       `json:"winners,omitempty"`
+	Rolled   []string       `json:"rolled,omitempty"`
+}
@@ -0,0 +1,173 @@
+package proto
+
+const (
+	CMD_GAME_LOGIN_REQ uint32 = 2001 // 登录请求, 凭大厅匹配下发的票据登录
+	CMD_GAME_LOGIN_RSP uint32 = 2002 // 登录响应
+
+	CMD_GAME_ROOM_LIST_REQ     uint32 = 2101 // 房间列表请求
+	CMD_GAME_ROOM_LIST_RSP     uint32 = 2102 // 房间列表响应
+	CMD_GAME_ROOM_CREATE_REQ   uint32 = 2103 // 创建房间请求
+	CMD_GAME_ROOM_CREATE_RSP   uint32 = 2104 // 创建房间响应
+	CMD_GAME_ROOM_JOIN_REQ     uint32 = 2105 // 加入房间请求
+	CMD_GAME_ROOM_JOIN_RSP     uint32 = 2106 // 加入房间响应
+	CMD_GAME_ROOM_LEAVE_REQ    uint32 = 2107 // 离开房间请求
+	CMD_GAME_ROOM_LEAVE_RSP    uint32 = 2108 // 离开房间响应
+	CMD_GAME_ROOM_READY_REQ    uint32 = 2109 // 准备/取消准备请求
+	CMD_GAME_ROOM_READY_RSP    uint32 = 2110 // 准备/取消准备响应
+	CMD_GAME_ROOM_EVENT_NOTIFY uint32 = 2111 // 房间事件通知
+
+	CMD_GAME_LOGIC_REQ    uint32 = 2201 // 游戏逻辑消息, 消息体由各游戏逻辑定义
+	CMD_GAME_LOGIC_NOTIFY uint32 = 2202 // 游戏逻辑推送, 消息体由各游戏逻辑定义
+	CMD_GAME_STATE_NOTIFY uint32 = 2203 // 固定帧率房间的状态变化推送
+	CMD_GAME_FAIR_NOTIFY  uint32 = 2204 // 一局开始前公布随机数种子承诺, 开局时公布公开种子, 一局结束时公布服务器种子
+
+	CMD_GAME_REPLAY_REQ        uint32 = 2301 // 观看录像请求
+	CMD_GAME_REPLAY_RSP        uint32 = 2302 // 观看录像响应
+	CMD_GAME_REPLAY_END_NOTIFY uint32 = 2303 // 录像播放结束
+)
+
+// 房间状态
+const (
+	ROOM_STATE_WAITING = 0 // 等待玩家加入和准备
+	ROOM_STATE_PLAYING = 1 // 游戏中
+	ROOM_STATE_CLOSED  = 2 // 已关闭
+)
+
+// 房间事件
+const (
+	ROOM_EVENT_JOINED      = 1  // 玩家加入
+	ROOM_EVENT_LEFT        = 2  // 玩家离开
+	ROOM_EVENT_READY       = 3  // 玩家准备状态变化
+	ROOM_EVENT_OWNER       = 4  // 房主变化
+	ROOM_EVENT_STARTED     = 5  // 游戏开始
+	ROOM_EVENT_ENDED       = 6  // 游戏结束
+	ROOM_EVENT_CLOSED      = 7  // 房间关闭
+	ROOM_EVENT_OFFLINE     = 8  // 玩家掉线
+	ROOM_EVENT_RECONNECTED = 9  // 玩家掉线重连
+	ROOM_EVENT_PAUSED      = 10 // 游戏暂停
+	ROOM_EVENT_RESUMED     = 11 // 游戏恢复
+	ROOM_EVENT_WATCHED     = 12 // 观战者加入
+	ROOM_EVENT_UNWATCHED   = 13 // 观战者离开
+)
+
+type GameLoginReq struct {
+	Ticket string `json:"ticket"`
+}
+
+// 登录成功后自动加入预留的房间, Room 为房间信息;
+// 游戏中掉线后凭同一票据重新登录时 Reconnect 为 true, 随后下发完整状态;
+// 凭观战票据登录时 Spectate 为 true, 不占座位, 只接收房间推送, 离开房间即结束观战
+type GameLoginRsp struct {
+	Code      int       `json:"code"`
+	Msg       string    `json:"msg"`
+	Name      string    `json:"name"`
+	RoomId    string    `json:"roomId"`
+	Kind      string    `json:"kind"`
+	Room      *RoomInfo `json:"room,omitempty"`
+	Reconnect bool      `json:"reconnect,omitempty"`
+	Spectate  bool      `json:"spectate,omitempty"`
+}
+
+// 座位, Name 为空表示空座位
+type RoomSeat struct {
+	Seat   int    `json:"seat"`
+	Name   string `json:"name"`
+	Ready  bool   `json:"ready"`
+	Online bool   `json:"online"`
+	Bot    bool   `json:"bot,omitempty"`
+}
+
+type RoomInfo struct {
+	Id         string      `json:"id"`
+	Kind       string      `json:"kind"`
+	Owner      string      `json:"owner"`
+	Capacity   int         `json:"capacity"`
+	State      int         `json:"state"`
+	Paused     bool        `json:"paused"`
+	Private    bool        `json:"private"` // 预留给匹配玩家的房间, 其他玩家不能加入
+	Seats      []*RoomSeat `json:"seats"`
+	Spectators int         `json:"spectators"` // 观战人数
+}
+
+type GameRoomListReq struct {
+	Kind string `json:"kind"`
+}
+
+type GameRoomListRsp struct {
+	Code  int         `json:"code"`
+	Msg   string      `json:"msg"`
+	Rooms []*RoomInfo `json:"rooms"`
+}
+
+type GameRoomCreateReq struct {
+	Kind     string `json:"kind"`
+	Capacity int    `json:"capacity"`
+}
+
+type GameRoomJoinReq struct {
+	RoomId string `json:"roomId"`
+}
+
+type GameRoomLeaveReq struct {
+}
+
+// ClientSeed 为客户端随机生成的种子, 准备时提交, 用于计算本局的公开种子, 长度不超过 64
+type GameRoomReadyReq struct {
+	Ready      bool   `json:"ready"`
+	ClientSeed string `json:"clientSeed"`
+}
+
+// 创建、加入、离开、准备的响应
+type GameRoomRsp struct {
+	Code int       `json:"code"`
+	Msg  string    `json:"msg"`
+	Seat int       `json:"seat"`
+	Room *RoomInfo `json:"room,omitempty"`
+}
+
+type GameRoomEventNotify struct {
+	Event int       `json:"event"`
+	Name  string    `json:"name"`
+	Room  *RoomInfo `json:"room"`
+}
+
+// 随机数种子推送
+const (
+	FAIR_STAGE_COMMIT = "commit" // 一局开始前, 房间创建、加入房间或上一局结束时, Seed 只有 Commitment
+	FAIR_STAGE_START  = "start"  // 开局, Seed 包含 Commitment、ClientSeeds 和 PublicSeed
+	FAIR_STAGE_REVEAL = "reveal" // 一局结束, Seed 包含 ServerSeed 和 Seed, 客户端可用 FairSeed.Verify 校验
+)
+
+type GameFairNotify struct {
+	Stage  string    `json:"stage"`
+	RoomId string    `json:"roomId"`
+	Seed   *FairSeed `json:"seed"`
+}
+
+// 状态推送, Full 为 true 时为完整状态, 否则 Changed 为变化的 key, Removed 为删除的 key
+type GameStateNotify struct {
+	Frame   int64                  `json:"frame"`
+	Full    bool                   `json:"full,omitempty"`
+	Changed map[string]interface{} `json:"changed,omitempty"`
+	Removed []string               `json:"removed,omitempty"`
+}
+
+// 观看录像, 只允许该局的玩家观看, 按原始时间间隔以原命令号推送该局的广播和发给本人的消息,
+// Speed 为播放倍速, 0 为 1 倍
+type GameReplayReq struct {
+	Id    string  `json:"id"`
+	Speed float64 `json:"speed"`
+}
+
+type GameReplayRsp struct {
+	Code  int      `json:"code"`
+	Msg   string   `json:"msg"`
+	Id    string   `json:"id"`
+	Kind  string   `json:"kind"`
+	Start int64    `json:"start"`
+	Seats []string `json:"seats"`
+}
+
+type GameReplayEndNotify struct {
+	Id string `json:"id"`
+}
@@ -1,20 +1,451 @@
 package proto
 
 const (
-	CMD_PLAZA_LOGIN_REQ        uint32 = 1001 // 登录请求
-	CMD_PLAZA_LOGIN_RSP        uint32 = 1002 // 登录响应
-	CMD_PLAZA_GAME_LIST_NOTIFY uint32 = 1003 // 游戏服务列表通知
+	CMD_PLAZA_LOGIN_REQ          uint32 = 1001 // 登录请求
+	CMD_PLAZA_LOGIN_RSP          uint32 = 1002 // 登录响应
+	CMD_PLAZA_GAME_LIST_NOTIFY   uint32 = 1003 // 游戏服务列表通知
+	CMD_PLAZA_LOGIN_QUEUE_NOTIFY uint32 = 1004 // 登录排队进度通知
+	CMD_PLAZA_KICK_NOTIFY        uint32 = 1005 // 踢下线通知
+	CMD_PLAZA_MAINTENANCE_NOTIFY uint32 = 1006 // 停服维护通知
+	CMD_PLAZA_ACCOUNT_BIND_REQ   uint32 = 1007 // 游客绑定账号请求
+	CMD_PLAZA_ACCOUNT_BIND_RSP   uint32 = 1008 // 游客绑定账号响应
+
+	CMD_PLAZA_CHAT_JOIN_REQ   uint32 = 1101 // 加入聊天频道请求
+	CMD_PLAZA_CHAT_JOIN_RSP   uint32 = 1102 // 加入聊天频道响应
+	CMD_PLAZA_CHAT_LEAVE_REQ  uint32 = 1103 // 离开聊天频道请求
+	CMD_PLAZA_CHAT_LEAVE_RSP  uint32 = 1104 // 离开聊天频道响应
+	CMD_PLAZA_CHAT_SEND_REQ   uint32 = 1105 // 发送聊天消息请求
+	CMD_PLAZA_CHAT_SEND_RSP   uint32 = 1106 // 发送聊天消息响应
+	CMD_PLAZA_CHAT_MSG_NOTIFY uint32 = 1107 // 聊天消息通知
+
+	CMD_PLAZA_USER_LOOKUP_REQ uint32 = 1201 // 查询用户在线状态请求
+	CMD_PLAZA_USER_LOOKUP_RSP uint32 = 1202 // 查询用户在线状态响应
+
+	CMD_PLAZA_FRIEND_LIST_REQ       uint32 = 1301 // 好友列表请求
+	CMD_PLAZA_FRIEND_LIST_RSP       uint32 = 1302 // 好友列表响应
+	CMD_PLAZA_FRIEND_ADD_REQ        uint32 = 1303 // 发送好友申请请求
+	CMD_PLAZA_FRIEND_ADD_RSP        uint32 = 1304 // 发送好友申请响应
+	CMD_PLAZA_FRIEND_ACCEPT_REQ     uint32 = 1305 // 同意好友申请请求
+	CMD_PLAZA_FRIEND_ACCEPT_RSP     uint32 = 1306 // 同意好友申请响应
+	CMD_PLAZA_FRIEND_REJECT_REQ     uint32 = 1307 // 拒绝好友申请请求
+	CMD_PLAZA_FRIEND_REJECT_RSP     uint32 = 1308 // 拒绝好友申请响应
+	CMD_PLAZA_FRIEND_REMOVE_REQ     uint32 = 1309 // 删除好友请求
+	CMD_PLAZA_FRIEND_REMOVE_RSP     uint32 = 1310 // 删除好友响应
+	CMD_PLAZA_FRIEND_REQUEST_NOTIFY uint32 = 1311 // 收到好友申请通知
+	CMD_PLAZA_FRIEND_CHANGE_NOTIFY  uint32 = 1312 // 好友关系变化通知
+	CMD_PLAZA_FRIEND_STATUS_NOTIFY  uint32 = 1313 // 好友在线状态变化通知
+
+	CMD_PLAZA_MATCH_REQ        uint32 = 1401 // 加入匹配队列请求
+	CMD_PLAZA_MATCH_RSP        uint32 = 1402 // 加入匹配队列响应
+	CMD_PLAZA_MATCH_CANCEL_REQ uint32 = 1403 // 取消匹配请求
+	CMD_PLAZA_MATCH_CANCEL_RSP uint32 = 1404 // 取消匹配响应
+	CMD_PLAZA_MATCH_NOTIFY     uint32 = 1405 // 匹配结果通知
+	CMD_PLAZA_WATCH_REQ        uint32 = 1411 // 观战请求
+	CMD_PLAZA_WATCH_RSP        uint32 = 1412 // 观战响应
+
+	CMD_PLAZA_PROFILE_GET_REQ    uint32 = 1501 // 查询玩家资料请求
+	CMD_PLAZA_PROFILE_GET_RSP    uint32 = 1502 // 查询玩家资料响应
+	CMD_PLAZA_PROFILE_UPDATE_REQ uint32 = 1503 // 修改玩家资料请求
+	CMD_PLAZA_PROFILE_UPDATE_RSP uint32 = 1504 // 修改玩家资料响应
+	CMD_PLAZA_SETTLE_NOTIFY      uint32 = 1505 // 游戏结算通知, 附带更新后的资料
+
+	CMD_PLAZA_MAIL_LIST_REQ   uint32 = 1601 // 邮件列表请求
+	CMD_PLAZA_MAIL_LIST_RSP   uint32 = 1602 // 邮件列表响应
+	CMD_PLAZA_MAIL_READ_REQ   uint32 = 1603 // 读邮件请求
+	CMD_PLAZA_MAIL_READ_RSP   uint32 = 1604 // 读邮件响应
+	CMD_PLAZA_MAIL_CLAIM_REQ  uint32 = 1605 // 领取邮件附件请求
+	CMD_PLAZA_MAIL_CLAIM_RSP  uint32 = 1606 // 领取邮件附件响应
+	CMD_PLAZA_MAIL_DELETE_REQ uint32 = 1607 // 删除邮件请求
+	CMD_PLAZA_MAIL_DELETE_RSP uint32 = 1608 // 删除邮件响应
+	CMD_PLAZA_MAIL_NEW_NOTIFY uint32 = 1609 // 新邮件通知
+
+	CMD_PLAZA_ADMIN_BAN_ADD_REQ  uint32 = 1901 // 添加封禁请求
+	CMD_PLAZA_ADMIN_BAN_ADD_RSP  uint32 = 1902 // 添加封禁响应
+	CMD_PLAZA_ADMIN_BAN_LIST_REQ uint32 = 1903 // 封禁列表请求
+	CMD_PLAZA_ADMIN_BAN_LIST_RSP uint32 = 1904 // 封禁列表响应
+	CMD_PLAZA_ADMIN_BAN_LIFT_REQ uint32 = 1905 // 解除封禁请求
+	CMD_PLAZA_ADMIN_BAN_LIFT_RSP uint32 = 1906 // 解除封禁响应
+
+	CMD_PLAZA_ADMIN_MAINTENANCE_REQ uint32 = 1911 // 设置停服维护请求
+	CMD_PLAZA_ADMIN_MAINTENANCE_RSP uint32 = 1912 // 设置停服维护响应
+
+	CMD_PLAZA_ADMIN_MAIL_SEND_REQ uint32 = 1921 // 发送邮件请求
+	CMD_PLAZA_ADMIN_MAIL_SEND_RSP uint32 = 1922 // 发送邮件响应
 )
 
+const (
+	CHAT_CHANNEL_WORLD = "world" // 世界频道, 所有在线用户默认加入
+)
+
+// 好友状态
+const (
+	FRIEND_STATUS_OFFLINE = 0 // 离线
+	FRIEND_STATUS_ONLINE  = 1 // 在线
+	FRIEND_STATUS_IN_GAME = 2 // 游戏中
+)
+
+// 好友关系变化事件
+const (
+	FRIEND_EVENT_ACCEPTED = "accepted" // 对方同意了好友申请
+	FRIEND_EVENT_REJECTED = "rejected" // 对方拒绝了好友申请
+	FRIEND_EVENT_REMOVED  = "removed"  // 对方删除了好友
+)
+
+// 登录响应中的客户端更新提示
+const (
+	UPDATE_NONE    = 0 // 无需更新
+	UPDATE_SUGGEST = 1 // 建议更新, 可以继续登录
+	UPDATE_FORCE   = 2 // 必须更新, 登录被拒绝
+)
+
+// Provider 不为空时使用第三方平台的 Token 登录;
+// 否则 Account 为空时游客登录, 同一 DeviceId 的游客登录返回同一游客账号
 type PlazaLoginReq struct {
+	Account  string `json:"account"`
+	Passwd   string `json:"passwd"`
+	Provider string `json:"provider"`
+	Token    string `json:"token"`
+	DeviceId string `json:"deviceId"`
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
 }
 
 type PlazaLoginRsp struct {
+	Code        int              `json:"code"`
+	Msg         string           `json:"msg"`
+	Name        string           `json:"name"`
+	Update      int              `json:"update,omitempty"`
+	UpdateUrl   string           `json:"updateUrl,omitempty"`
+	Profile     *Profile         `json:"profile,omitempty"`
+	Ban         *BanInfo         `json:"ban,omitempty"`
+	Maintenance *MaintenanceInfo `json:"maintenance,omitempty"`
+}
+
+// 游客绑定登录账号密码, 绑定后用户名和资料不变, 之后使用账号密码登录
+type PlazaAccountBindReq struct {
+	Account string `json:"account"`
+	Passwd  string `json:"passwd"`
+}
+
+type PlazaAccountBindRsp struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	Account string `json:"account"`
+}
+
+type PlazaKickNotify struct {
+	Code int      `json:"code"`
+	Msg  string   `json:"msg"`
+	Ban  *BanInfo `json:"ban,omitempty"`
+}
+
+// Wait 为预计等待秒数, -1 表示暂时无法估计
+type PlazaLoginQueueNotify struct {
+	Position int `json:"position"`
+	Wait     int `json:"wait"`
+}
+
+type BroadcastNotify struct {
+	Msg string `json:"msg"`
+}
+
+// 聊天消息, Channel 为空且 To 不为空时为私聊
+type ChatMsg struct {
+	Channel string `json:"channel"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Content string `json:"content"`
+	Time    int64  `json:"time"`
+}
+
+type PlazaChatJoinReq struct {
+	Channel string `json:"channel"`
+}
+
+type PlazaChatJoinRsp struct {
+	Code    int        `json:"code"`
+	Msg     string     `json:"msg"`
+	Channel string     `json:"channel"`
+	History []*ChatMsg `json:"history"`
+}
+
+type PlazaChatLeaveReq struct {
+	Channel string `json:"channel"`
+}
+
+type PlazaChatLeaveRsp struct {
+	Code    int    `json:"code"`
+	Msg     string `json:"msg"`
+	Channel string `json:"channel"`
+}
+
+type PlazaChatSendReq struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Content string `json:"content"`
+}
+
+type PlazaChatSendRsp struct {
 	Code int    `json:"code"`
 	Msg  string `json:"msg"`
+}
+
+type PlazaUserLookupReq struct {
+	Names []string `json:"names"`
+}
+
+type PlazaUserStatus struct {
+	Name   string `json:"name"`
+	Online bool   `json:"online"`
+	Plaza  string `json:"plaza"`
+	Game   string `json:"game"`
+}
+
+type PlazaUserLookupRsp struct {
+	Code  int                `json:"code"`
+	Msg   string             `json:"msg"`
+	Users []*PlazaUserStatus `json:"users"`
+}
+
+type FriendInfo struct {
+	Name   string `json:"name"`
+	Status int    `json:"status"`
+	Game   string `json:"game"`
+}
+
+type PlazaFriendListReq struct {
+}
+
+type PlazaFriendListRsp struct {
+	Code     int           `json:"code"`
+	Msg      string        `json:"msg"`
+	Friends  []*FriendInfo `json:"friends"`
+	Requests []string      `json:"requests"`
+}
+
+// 好友申请、同意、拒绝、删除请求均以对方用户名为参数
+type PlazaFriendReq struct {
 	Name string `json:"name"`
 }
 
-type BroadcastNotify struct {
-	Msg string `json:"msg"`
+type PlazaFriendRsp struct {
+	Code   int         `json:"code"`
+	Msg    string      `json:"msg"`
+	Friend *FriendInfo `json:"friend,omitempty"`
+}
+
+type PlazaFriendRequestNotify struct {
+	Name string `json:"name"`
+}
+
+type PlazaFriendChangeNotify struct {
+	Event  string      `json:"event"`
+	Friend *FriendInfo `json:"friend"`
+}
+
+type PlazaFriendStatusNotify struct {
+	Friend *FriendInfo `json:"friend"`
+}
+
+// Rating 为可选的匹配分, 分差在匹配窗口内的玩家才会被匹配到一起
+type PlazaMatchReq struct {
+	Kind   string `json:"kind"`
+	Rating int    `json:"rating"`
+}
+
+type PlazaMatchRsp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Kind string `json:"kind"`
+}
+
+type PlazaMatchCancelReq struct {
+}
+
+type PlazaMatchCancelRsp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// 匹配成功时 Code 为 0, 客户端使用 Ticket 连接 Addr 进入游戏; 匹配超时 Code 为 CODE_TIMEOUT
+type PlazaMatchNotify struct {
+	Code    int      `json:"code"`
+	Msg     string   `json:"msg"`
+	Kind    string   `json:"kind"`
+	Game    string   `json:"game"`
+	Addr    string   `json:"addr"`
+	RoomId  string   `json:"roomId"`
+	Ticket  string   `json:"ticket"`
+	Players []string `json:"players"`
+}
+
+// 玩家资料, Settings 为客户端自定义的设置数据, Settings 和 Assets 只返回给本人
+type Profile struct {
+	Name      string           `json:"name"`
+	Nickname  string           `json:"nickname"`
+	Avatar    int              `json:"avatar"`
+	Level     int              `json:"level"`
+	Exp       int64            `json:"exp"`
+	Created   int64            `json:"created"`
+	LastLogin int64            `json:"lastLogin"`
+	Settings  string           `json:"settings,omitempty"`
+	Assets    map[string]int64 `json:"assets,omitempty"` // 道具/货币 -> 数量
+}
+
+// Name 为空时查询自己的资料
+type PlazaProfileGetReq struct {
+	Name string `json:"name"`
+}
+
+type PlazaProfileGetRsp struct {
+	Code    int      `json:"code"`
+	Msg     string   `json:"msg"`
+	Profile *Profile `json:"profile"`
+}
+
+// 只修改不为空的字段
+type PlazaProfileUpdateReq struct {
+	Nickname *string `json:"nickname"`
+	Avatar   *int    `json:"avatar"`
+	Settings *string `json:"settings"`
+}
+
+type PlazaProfileUpdateRsp struct {
+	Code    int      `json:"code"`
+	Msg     string   `json:"msg"`
+	Profile *Profile `json:"profile"`
+}
+
+// 一局结束后推送给在线玩家, Result 为本人的结算结果
+type PlazaSettleNotify struct {
+	Id      string            `json:"id"`
+	Game    string            `json:"game"`
+	RoomId  string            `json:"roomId"`
+	Kind    string            `json:"kind"`
+	Result  *SettlementResult `json:"result"`
+	Profile *Profile          `json:"profile"`
+}
+
+// 邮件, Attachments 为附件 道具/货币 -> 数量, Expire 为过期时间(Unix 秒), 0 为永不过期
+type Mail struct {
+	Id          string           `json:"id"`
+	From        string           `json:"from"`
+	Title       string           `json:"title"`
+	Content     string           `json:"content"`
+	Attachments map[string]int64 `json:"attachments,omitempty"`
+	Created     int64            `json:"created"`
+	Expire      int64            `json:"expire"`
+	Read        bool             `json:"read"`
+	Claimed     bool             `json:"claimed"`
+}
+
+type PlazaMailListReq struct {
+}
+
+type PlazaMailListRsp struct {
+	Code  int     `json:"code"`
+	Msg   string  `json:"msg"`
+	Mails []*Mail `json:"mails"`
+}
+
+type PlazaMailReq struct {
+	Id string `json:"id"`
+}
+
+type PlazaMailRsp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Mail *Mail  `json:"mail"`
+}
+
+// 重复领取时 Code 为 0, Assets 为领取后的资产
+type PlazaMailClaimRsp struct {
+	Code   int              `json:"code"`
+	Msg    string           `json:"msg"`
+	Mail   *Mail            `json:"mail"`
+	Assets map[string]int64 `json:"assets"`
+}
+
+type PlazaMailNewNotify struct {
+	Mail *Mail `json:"mail"`
+}
+
+// 观战好友时填 Name, 观战指定房间时填 Game 和 RoomId
+type PlazaWatchReq struct {
+	Name   string `json:"name"`
+	Game   string `json:"game"`
+	RoomId string `json:"roomId"`
+}
+
+// 客户端使用 Ticket 连接 Addr 进入游戏服务器观战
+type PlazaWatchRsp struct {
+	Code   int    `json:"code"`
+	Msg    string `json:"msg"`
+	Game   string `json:"game"`
+	Addr   string `json:"addr"`
+	Ticket string `json:"ticket"`
+}
+
+// 维护开始、倒计时、结束时推送, KickAt 为踢下线时间(Unix 秒), 0 为不踢人
+type PlazaMaintenanceNotify struct {
+	Enabled bool   `json:"enabled"`
+	Msg     string `json:"msg"`
+	EndTime int64  `json:"endTime"`
+	KickAt  int64  `json:"kickAt"`
+}
+
+// Duration 为封禁时长, 单位秒, 0 为永久封禁
+type PlazaAdminBanAddReq struct {
+	Type     string `json:"type"`
+	Target   string `json:"target"`
+	Reason   string `json:"reason"`
+	Duration int64  `json:"duration"`
+}
+
+type PlazaAdminBanAddRsp struct {
+	Code int      `json:"code"`
+	Msg  string   `json:"msg"`
+	Ban  *BanInfo `json:"ban"`
+}
+
+type PlazaAdminBanListReq struct {
+}
+
+type PlazaAdminBanListRsp struct {
+	Code int        `json:"code"`
+	Msg  string     `json:"msg"`
+	Bans []*BanInfo `json:"bans"`
+}
+
+type PlazaAdminBanLiftReq struct {
+	Id string `json:"id"`
+}
+
+type PlazaAdminBanLiftRsp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+type PlazaAdminMaintenanceReq struct {
+	MaintenanceInfo
+}
+
+type PlazaAdminMaintenanceRsp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+// To 为空时发送全服邮件, Duration 为有效时长, 单位秒, 0 为永不过期
+type PlazaAdminMailSendReq struct {
+	To          []string         `json:"to"`
+	Title       string           `json:"title"`
+	Content     string           `json:"content"`
+	Attachments map[string]int64 `json:"attachments"`
+	Duration    int64            `json:"duration"`
+}
+
+type PlazaAdminMailSendRsp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Id   string `json:"id"`
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
 	"github.com/nothollyhigh/kiss/log"
 	"github.com/nothollyhigh/kiss/net"
 	"github.com/nothollyhigh/kiss/util"
@@ -12,10 +15,28 @@ import (
 
 var (
 	plazaAddr = "ws://localhost:11000/gate/ws"
+
+	clientVersion  = "1.0.0"
+	clientPlatform = "robot"
+
+	robotNum  = flag.Int("n", 2, "robot num")
+	matchKind = flag.String("kind", proto.GAME_KIND_DICE, "match game kind")
+	rounds    = flag.Int("rounds", 3, "rounds to play")
 )
 
+// 每局随机生成客户端种子, 准备时提交
+func clientSeed() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// 机器人: 登录大厅 -> 匹配 -> 凭票据登录游戏服务器 -> 准备 -> 掷骰子
 type Robot struct {
 	Client *net.WSClient
+	Game   *net.WSClient
+	Name   string
+	Rounds int
 }
 
 func (robot *Robot) onPlazaLoginRsp(cli *net.WSClient, msg net.IMessage) {
@@ -29,18 +50,137 @@ func (robot *Robot) onPlazaLoginRsp(cli *net.WSClient, msg net.IMessage) {
 		return
 	}
 
+	if rsp.Update == proto.UPDATE_SUGGEST {
+		log.Info("onPlazaLoginRsp update suggested: %v", rsp.UpdateUrl)
+	}
+
 	if rsp.Code != 0 {
 		log.Error("onPlazaLoginRsp failed: %v, %v", rsp.Code, rsp.Msg)
 		return
 	}
 
+	robot.Name = rsp.Name
 	log.Info("onPlazaLoginRsp success, name: '%v'", rsp.Name)
+
+	cli.SendMsg(proto.NewMessage(proto.CMD_PLAZA_MATCH_REQ, &proto.PlazaMatchReq{Kind: *matchKind}))
 }
 
 func (robot *Robot) onGameList(cli *net.WSClient, msg net.IMessage) {
 	log.Info("onGameList: %v", string(msg.Body()))
 }
 
+func (robot *Robot) onPlazaMatchRsp(cli *net.WSClient, msg net.IMessage) {
+	log.Info("[%v] onPlazaMatchRsp: %v", robot.Name, string(msg.Body()))
+}
+
+func (robot *Robot) onPlazaMatchNotify(cli *net.WSClient, msg net.IMessage) {
+	var (
+		notify = &proto.PlazaMatchNotify{}
+	)
+
+	if err := proto.Unmarshal(msg.Body(), notify); err != nil {
+		log.Error("onPlazaMatchNotify Unmarshal failed: %v", err)
+		return
+	}
+
+	if notify.Code != 0 {
+		log.Error("[%v] onPlazaMatchNotify failed: %v, %v", robot.Name, notify.Code, notify.Msg)
+		return
+	}
+
+	log.Info("[%v] matched, game: %v, room: %v, players: %v", robot.Name, notify.Game, notify.RoomId, notify.Players)
+
+	game, err := net.NewWebsocketClient(notify.Addr)
+	if err != nil {
+		log.Error("[%v] connect game %v failed: %v", robot.Name, notify.Addr, err)
+		return
+	}
+	robot.Game = game
+
+	game.Handle(proto.CMD_GAME_LOGIN_RSP, robot.onGameLoginRsp)
+	game.Handle(proto.CMD_GAME_ROOM_READY_RSP, robot.onGameRoomRsp)
+	game.Handle(proto.CMD_GAME_ROOM_EVENT_NOTIFY, robot.onGameRoomEvent)
+	game.Handle(proto.CMD_GAME_LOGIC_NOTIFY, robot.onDiceNotify)
+
+	game.SendMsg(proto.NewMessage(proto.CMD_GAME_LOGIN_REQ, &proto.GameLoginReq{Ticket: notify.Ticket}))
+
+	util.Go(func() {
+		game.Keepalive(time.Second * 5)
+	})
+}
+
+func (robot *Robot) onGameLoginRsp(cli *net.WSClient, msg net.IMessage) {
+	var (
+		rsp = &proto.GameLoginRsp{}
+	)
+
+	if err := proto.Unmarshal(msg.Body(), rsp); err != nil {
+		log.Error("onGameLoginRsp Unmarshal failed: %v", err)
+		return
+	}
+
+	if rsp.Code != 0 {
+		log.Error("[%v] onGameLoginRsp failed: %v, %v", robot.Name, rsp.Code, rsp.Msg)
+		return
+	}
+
+	log.Info("[%v] onGameLoginRsp success, room: %v", robot.Name, rsp.RoomId)
+
+	cli.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_READY_REQ, &proto.GameRoomReadyReq{Ready: true, ClientSeed: clientSeed()}))
+}
+
+func (robot *Robot) onGameRoomRsp(cli *net.WSClient, msg net.IMessage) {
+	log.Debug("[%v] onGameRoomRsp: %v", robot.Name, string(msg.Body()))
+}
+
+func (robot *Robot) onGameRoomEvent(cli *net.WSClient, msg net.IMessage) {
+	var (
+		notify = &proto.GameRoomEventNotify{}
+	)
+
+	if err := proto.Unmarshal(msg.Body(), notify); err != nil {
+		log.Error("onGameRoomEvent Unmarshal failed: %v", err)
+		return
+	}
+
+	switch notify.Event {
+	case proto.ROOM_EVENT_STARTED:
+		log.Info("[%v] game started, roll", robot.Name)
+		cli.SendMsg(proto.NewMessage(proto.CMD_GAME_LOGIC_REQ, &proto.DiceReq{Action: proto.DICE_ACTION_ROLL}))
+	case proto.ROOM_EVENT_ENDED:
+		robot.Rounds++
+		if robot.Rounds >= *rounds {
+			log.Info("[%v] played %v rounds, leave", robot.Name, robot.Rounds)
+			cli.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_LEAVE_REQ, &proto.GameRoomLeaveReq{}))
+			return
+		}
+		util.Go(func() {
+			time.Sleep(time.Second)
+			cli.SendMsg(proto.NewMessage(proto.CMD_GAME_ROOM_READY_REQ, &proto.GameRoomReadyReq{Ready: true, ClientSeed: clientSeed()}))
+		})
+	}
+}
+
+func (robot *Robot) onDiceNotify(cli *net.WSClient, msg net.IMessage) {
+	var (
+		notify = &proto.DiceNotify{}
+	)
+
+	if err := proto.Unmarshal(msg.Body(), notify); err != nil {
+		log.Error("onDiceNotify Unmarshal failed: %v", err)
+		return
+	}
+
+	switch notify.Type {
+	case proto.DICE_NOTIFY_ROLLED:
+		if notify.Name == robot.Name {
+			log.Info("[%v] rolled %v", robot.Name, notify.Point)
+		}
+	case proto.DICE_NOTIFY_RESULT:
+		log.Info("[%v] result: %v, winners: %v", robot.Name, notify.Points, notify.Winners)
+	}
+}
+
 func NewRobot(addr string) (*Robot, error) {
 	cli, err := net.NewWebsocketClient(addr)
 	if err != nil {
@@ -54,9 +194,14 @@ func NewRobot(addr string) (*Robot, error) {
 
 	cli.Handle(proto.CMD_PLAZA_LOGIN_RSP, robot.onPlazaLoginRsp)
 	cli.Handle(proto.CMD_PLAZA_GAME_LIST_NOTIFY, robot.onGameList)
+	cli.Handle(proto.CMD_PLAZA_MATCH_RSP, robot.onPlazaMatchRsp)
+	cli.Handle(proto.CMD_PLAZA_MATCH_NOTIFY, robot.onPlazaMatchNotify)
 
 	// 登录
-	msg := proto.NewMessage(proto.CMD_PLAZA_LOGIN_REQ, &proto.PlazaLoginReq{})
+	msg := proto.NewMessage(proto.CMD_PLAZA_LOGIN_REQ, &proto.PlazaLoginReq{
+		Version:  clientVersion,
+		Platform: clientPlatform,
+	})
 	cli.SendMsg(msg)
 
 	// 心跳
@@ -68,7 +213,11 @@ func NewRobot(addr string) (*Robot, error) {
 }
 
 func main() {
-	NewRobot(plazaAddr)
+	flag.Parse()
+
+	for i := 0; i < *robotNum; i++ {
+		NewRobot(plazaAddr)
+	}
 
 	util.HandleSignal(func(sig os.Signal) {
 		if sig == syscall.SIGTERM || sig == syscall.SIGINT {
@@ -0,0 +1,140 @@
+package session
+
+import (
+	"github.com/nothollyhigh/kiss/log"
+	"github.com/nothollyhigh/kiss/net"
+	"kisscluster/proto"
+	stdnet "net"
+	"sync"
+)
+
+const (
+	DefaultKickThreshold = 10
+)
+
+type Handler func(client *net.TcpClient, msg net.IMessage)
+
+// 包装 net.TcpServer 的命令注册, 为每个连接维护 Session, 并在调用 handler 前检查权限
+// 未授权的请求下发 CMD_ERROR_NOTIFY, 累计达到 KickThreshold 次后断开连接
+type Router struct {
+	sync.RWMutex
+
+	server   *net.TcpServer
+	sessions map[*net.TcpClient]*Session
+	trusted  []*stdnet.IPNet
+
+	KickThreshold int
+}
+
+func NewRouter(server *net.TcpServer) *Router {
+	return &Router{
+		server:        server,
+		sessions:      map[*net.TcpClient]*Session{},
+		KickThreshold: DefaultKickThreshold,
+	}
+}
+
+// 获取连接的 Session, 不存在时创建, 连接断开时自动删除
+func (router *Router) Session(client *net.TcpClient) *Session {
+	router.RLock()
+	sess, ok := router.sessions[client]
+	router.RUnlock()
+	if ok {
+		return sess
+	}
+
+	router.Lock()
+	defer router.Unlock()
+
+	if sess, ok = router.sessions[client]; ok {
+		return sess
+	}
+
+	sess = &Session{Client: client}
+	router.sessions[client] = sess
+	client.OnClose("session", func(c *net.TcpClient) {
+		router.Lock()
+		delete(router.sessions, c)
+		router.Unlock()
+	})
+
+	return sess
+}
+
+// 接收网关转发的客户端真实 IP, 只信任来自 trusted 地址(IP 或 CIDR)的连接
+func (router *Router) HandleRealIp(trusted []string) error {
+	nets, err := ParseNets(trusted)
+	if err != nil {
+		return err
+	}
+
+	router.Lock()
+	router.trusted = nets
+	router.Unlock()
+
+	router.server.Handle(net.CMD_SET_REAL_IP, func(client *net.TcpClient, msg net.IMessage) {
+		sess := router.Session(client)
+		from := hostOf(client.Conn.RemoteAddr())
+
+		router.RLock()
+		ok := ContainsIp(router.trusted, from)
+		router.RUnlock()
+		if !ok {
+			log.Info("Router ignore real ip from untrusted %v", from)
+			return
+		}
+
+		ip := string(msg.Body())
+		if stdnet.ParseIP(ip) == nil {
+			log.Error("Router invalid real ip from %v: %v", from, ip)
+			return
+		}
+		sess.setRealIp(ip)
+	})
+
+	return nil
+}
+
+// 注册无需登录的命令
+func (router *Router) HandlePublic(cmd uint32, handler Handler) {
+	router.server.Handle(cmd, func(client *net.TcpClient, msg net.IMessage) {
+		router.Session(client)
+		handler(client, msg)
+	})
+}
+
+// 注册需要登录的命令
+func (router *Router) HandleAuth(cmd uint32, handler Handler) {
+	router.HandleRole(cmd, ROLE_USER, handler)
+}
+
+// 注册需要登录且角色不低于 role 的命令
+func (router *Router) HandleRole(cmd uint32, role int, handler Handler) {
+	router.server.Handle(cmd, func(client *net.TcpClient, msg net.IMessage) {
+		sess := router.Session(client)
+		if !sess.Authed() || sess.Role() < role {
+			router.deny(sess, cmd)
+			return
+		}
+		handler(client, msg)
+	})
+}
+
+func (router *Router) deny(sess *Session, cmd uint32) {
+	notify := &proto.ErrorNotify{
+		Cmd:  cmd,
+		Code: proto.CODE_UNAUTHORIZED,
+		Msg:  "unauthorized",
+	}
+
+	denied := sess.deny()
+	if router.KickThreshold > 0 && denied >= router.KickThreshold {
+		log.Info("Router kick client %v: %v unauthorized requests, last cmd: %v", sess.Client.Conn.RemoteAddr(), denied, cmd)
+		sess.Client.SendMsgWithCallback(proto.NewMessage(proto.CMD_ERROR_NOTIFY, notify), func(c *net.TcpClient, err error) {
+			c.Stop()
+		})
+		return
+	}
+
+	sess.Client.SendMsg(proto.NewMessage(proto.CMD_ERROR_NOTIFY, notify))
+}
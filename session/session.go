@@ -0,0 +1,105 @@
+package session
+
+import (
+	"github.com/nothollyhigh/kiss/net"
+	"sync"
+)
+
+// 角色, 数值越大权限越高
+const (
+	ROLE_USER  = 0
+	ROLE_ADMIN = 100
+)
+
+// 客户端连接的会话, 登录成功后绑定用户名和角色
+type Session struct {
+	sync.RWMutex
+
+	Client *net.TcpClient
+
+	name   string
+	role   int
+	authed bool
+	denied int
+	realIp string
+}
+
+// 登录成功后调用, 之后可以访问需要登录的命令
+func (sess *Session) Auth(name string, role int) {
+	sess.Lock()
+	defer sess.Unlock()
+
+	sess.name = name
+	sess.role = role
+	sess.authed = true
+}
+
+// 撤销登录, 登录过程中后续步骤失败时调用
+func (sess *Session) Unauth() {
+	sess.Lock()
+	defer sess.Unlock()
+
+	sess.name = ""
+	sess.role = ROLE_USER
+	sess.authed = false
+}
+
+func (sess *Session) Authed() bool {
+	sess.RLock()
+	defer sess.RUnlock()
+
+	return sess.authed
+}
+
+func (sess *Session) Name() string {
+	sess.RLock()
+	defer sess.RUnlock()
+
+	return sess.name
+}
+
+func (sess *Session) Role() int {
+	sess.RLock()
+	defer sess.RUnlock()
+
+	return sess.role
+}
+
+// 记录一次未授权请求, 返回累计次数
+func (sess *Session) deny() int {
+	sess.Lock()
+	defer sess.Unlock()
+
+	sess.denied++
+	return sess.denied
+}
+
+// 客户端 IP, 优先使用可信网关转发的真实 IP
+func (sess *Session) Ip() string {
+	sess.RLock()
+	realIp := sess.realIp
+	sess.RUnlock()
+
+	if realIp != "" {
+		return realIp
+	}
+	if sess.Client.Conn == nil {
+		return ""
+	}
+	return hostOf(sess.Client.Conn.RemoteAddr())
+}
+
+// 网关转发的真实 IP, 未收到时为空
+func (sess *Session) RealIp() string {
+	sess.RLock()
+	defer sess.RUnlock()
+
+	return sess.realIp
+}
+
+func (sess *Session) setRealIp(ip string) {
+	sess.Lock()
+	defer sess.Unlock()
+
+	sess.realIp = ip
+}